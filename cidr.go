@@ -0,0 +1,216 @@
+package hclconfig
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// cidrSubnetFunc calculates a subnet address within the given IP network
+// address prefix i.e. cidrsubnet("10.6.0.0/16", 8, 2) = 10.6.2.0/24
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "newbits",
+			Type: cty.Number,
+		},
+		{
+			Name: "netnum",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		newbits, err := wholeNumber(args[1], "newbits")
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		netnum, err := wholeNumber(args[2], "netnum")
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		ones, bits := network.Mask.Size()
+		if !newbits.IsInt64() || newbits.Int64() < 0 || ones+int(newbits.Int64()) > bits {
+			return cty.UnknownVal(cty.String), fmt.Errorf("insufficient address space to extend prefix %s by %s bits", network, newbits)
+		}
+
+		prefix := ones + int(newbits.Int64())
+
+		// netnum must fit in the new bits
+		max := new(big.Int).Lsh(big.NewInt(1), uint(newbits.Int64()))
+		if netnum.Sign() < 0 || netnum.Cmp(max) >= 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix extension of %s bits does not accommodate a subnet numbered %s", newbits, netnum)
+		}
+
+		ip := ipToInt(network.IP)
+		ip.Or(ip, new(big.Int).Lsh(netnum, uint(bits-prefix)))
+
+		return cty.StringVal(fmt.Sprintf("%s/%d", intToIP(ip, bits), prefix)), nil
+	},
+})
+
+// cidrHostFunc calculates the address of a host within the given IP network
+// address prefix, negative numbers count back from the end of the range
+// i.e. cidrhost("10.6.0.0/16", 10) = 10.6.0.10
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "hostnum",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		hostnum, err := wholeNumber(args[1], "hostnum")
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		ones, bits := network.Mask.Size()
+		max := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+
+		if hostnum.Sign() < 0 {
+			hostnum.Add(hostnum, max)
+		}
+
+		if hostnum.Sign() < 0 || hostnum.Cmp(max) >= 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix %s does not accommodate a host numbered %s", network, args[1].AsBigFloat().String())
+		}
+
+		ip := ipToInt(network.IP)
+		ip.Add(ip, hostnum)
+
+		return cty.StringVal(intToIP(ip, bits).String()), nil
+	},
+})
+
+// cidrNetmaskFunc returns the netmask for an IPv4 network address prefix
+// i.e. cidrnetmask("10.6.0.0/16") = 255.255.0.0
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		if len(network.Mask) != net.IPv4len {
+			return cty.UnknownVal(cty.String), fmt.Errorf("IPv6 prefix %s does not have a netmask", network)
+		}
+
+		return cty.StringVal(net.IP(network.Mask).String()), nil
+	},
+})
+
+// cidrContainsFunc returns true when the given IP address or network address
+// prefix is within the network address prefix
+// i.e. cidrcontains("10.6.0.0/16", "10.6.0.200") = true
+var cidrContainsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "address",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		network, err := parseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), err
+		}
+
+		address := args[1].AsString()
+
+		// the address can be a single ip or a network, a network is contained
+		// when both the first and last address are in the prefix
+		sub, err := parseCIDR(address)
+		if err == nil {
+			ones, bits := sub.Mask.Size()
+			last := ipToInt(sub.IP)
+			last.Add(last, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)), big.NewInt(1)))
+
+			return cty.BoolVal(network.Contains(sub.IP) && network.Contains(intToIP(last, bits))), nil
+		}
+
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return cty.UnknownVal(cty.Bool), fmt.Errorf("invalid IP address or network address prefix %s", address)
+		}
+
+		return cty.BoolVal(network.Contains(ip)), nil
+	},
+})
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network address prefix %s: %s", s, err)
+	}
+
+	return network, nil
+}
+
+// wholeNumber returns the cty number as a big.Int, an error is returned
+// when the number has a fractional part
+func wholeNumber(v cty.Value, name string) (*big.Int, error) {
+	bf := v.AsBigFloat()
+	if !bf.IsInt() {
+		return nil, fmt.Errorf("%s must be a whole number", name)
+	}
+
+	i, _ := bf.Int(nil)
+
+	return i, nil
+}
+
+// ipToInt converts an IPv4 or IPv6 address to an integer
+func ipToInt(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	return new(big.Int).SetBytes(ip)
+}
+
+// intToIP converts an integer to an IP address with the given number of bits
+func intToIP(i *big.Int, bits int) net.IP {
+	b := i.Bytes()
+
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(b):], b)
+
+	return ip
+}
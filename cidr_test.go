@@ -0,0 +1,102 @@
+package hclconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCIDRSubnet(t *testing.T) {
+	cases := []struct {
+		prefix  string
+		newbits int64
+		netnum  int64
+		want    string
+	}{
+		{"10.6.0.0/16", 8, 2, "10.6.2.0/24"},
+		{"10.6.0.0/16", 4, 15, "10.6.240.0/20"},
+		{"172.16.0.0/12", 0, 0, "172.16.0.0/12"},
+		{"fd00:fd12:3456:7890::/56", 16, 162, "fd00:fd12:3456:7800:a200::/72"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.want, func(t *testing.T) {
+			val, err := cidrSubnetFunc.Call([]cty.Value{cty.StringVal(c.prefix), cty.NumberIntVal(c.newbits), cty.NumberIntVal(c.netnum)})
+			require.NoError(t, err)
+			require.Equal(t, c.want, val.AsString())
+		})
+	}
+}
+
+func TestCIDRSubnetWithInvalidArgumentsReturnsError(t *testing.T) {
+	_, err := cidrSubnetFunc.Call([]cty.Value{cty.StringVal("10.6.0.0/16"), cty.NumberIntVal(17), cty.NumberIntVal(0)})
+	require.Error(t, err)
+
+	_, err = cidrSubnetFunc.Call([]cty.Value{cty.StringVal("10.6.0.0/16"), cty.NumberIntVal(2), cty.NumberIntVal(4)})
+	require.Error(t, err)
+
+	_, err = cidrSubnetFunc.Call([]cty.Value{cty.StringVal("10.6.0.0"), cty.NumberIntVal(2), cty.NumberIntVal(1)})
+	require.Error(t, err)
+}
+
+func TestCIDRHost(t *testing.T) {
+	cases := []struct {
+		prefix  string
+		hostnum int64
+		want    string
+	}{
+		{"10.6.0.0/16", 200, "10.6.0.200"},
+		{"10.6.0.0/16", 256, "10.6.1.0"},
+		{"10.6.0.0/16", -2, "10.6.255.254"},
+		{"fd00:fd12:3456:7890::/56", 34, "fd00:fd12:3456:7800::22"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.want, func(t *testing.T) {
+			val, err := cidrHostFunc.Call([]cty.Value{cty.StringVal(c.prefix), cty.NumberIntVal(c.hostnum)})
+			require.NoError(t, err)
+			require.Equal(t, c.want, val.AsString())
+		})
+	}
+}
+
+func TestCIDRHostOutsideRangeReturnsError(t *testing.T) {
+	_, err := cidrHostFunc.Call([]cty.Value{cty.StringVal("10.6.0.0/24"), cty.NumberIntVal(256)})
+	require.Error(t, err)
+
+	_, err = cidrHostFunc.Call([]cty.Value{cty.StringVal("10.6.0.0/24"), cty.NumberIntVal(-257)})
+	require.Error(t, err)
+}
+
+func TestCIDRNetmask(t *testing.T) {
+	val, err := cidrNetmaskFunc.Call([]cty.Value{cty.StringVal("10.6.0.0/12")})
+	require.NoError(t, err)
+	require.Equal(t, "255.240.0.0", val.AsString())
+
+	_, err = cidrNetmaskFunc.Call([]cty.Value{cty.StringVal("fd00::/56")})
+	require.Error(t, err)
+}
+
+func TestCIDRContains(t *testing.T) {
+	cases := []struct {
+		prefix  string
+		address string
+		want    bool
+	}{
+		{"10.6.0.0/16", "10.6.0.200", true},
+		{"10.6.0.0/16", "10.7.0.1", false},
+		{"10.6.0.0/16", "10.6.2.0/24", true},
+		{"10.6.0.0/16", "10.0.0.0/8", false},
+		{"fd00::/56", "fd00::22", true},
+		{"fd00::/56", "10.6.0.1", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.address, func(t *testing.T) {
+			val, err := cidrContainsFunc.Call([]cty.Value{cty.StringVal(c.prefix), cty.StringVal(c.address)})
+			require.NoError(t, err)
+			require.Equal(t, cty.BoolVal(c.want), val)
+		})
+	}
+}
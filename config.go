@@ -1,12 +1,16 @@
 package hclconfig
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/shipyard-run/hclconfig/types"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 type ResourceFQDN struct {
@@ -98,8 +102,55 @@ type Config struct {
 	Resources []types.Resource `json:"resources"`
 	contexts  map[types.Resource]*hcl.EvalContext
 	bodies    map[types.Resource]*hclsyntax.Body
+
+	// registeredTypes are used to create the concrete types when
+	// the config is decoded from JSON
+	registeredTypes types.RegisteredTypes
+
+	// impureFunctions are the names of the non-deterministic functions
+	// available when the config was parsed
+	impureFunctions map[string]bool
+
+	// variableFunctions are the functions called to set the variables
+	variableFunctions variableFunctions
+
+	// configFunctions are the functions with access to the config, they are
+	// used to add the dependencies of the resources that call them
+	configFunctions map[string]ConfigFunction
+
+	// env records the environment variables read by the config
+	env *envRecorder
+
+	// sources contains the contents of the parsed files, keyed by filename
+	sources map[string][]byte
+
+	// variables are the variable blocks defined in the config, module
+	// variables are not included
+	variables []*hclsyntax.Block
+
+	// states tracks the changes to resources when state is enabled
+	states *resourceStates
+
+	// targets are the resources that will be processed, when nil all
+	// resources are processed
+	targets map[types.Resource]bool
+
+	// onEvent is called to report progress while the config is processed
+	onEvent EventCallback
+
+	// retryPolicies keyed by resource type or FQDN
+	retryPolicies map[string]RetryPolicy
+
+	// warnings from the last walk of the graph
+	warnings tfdiags.Diagnostics
+
+	// validating is true when resources are decoded but not processed
+	validating bool
 }
 
+// Config implements types.ConfigReader so that it can be passed to types.Finalizer
+var _ types.ConfigReader = &Config{}
+
 // ResourceNotFoundError is thrown when a resource could not be found
 type ResourceNotFoundError struct {
 	Name string
@@ -282,6 +333,19 @@ func (c *Config) addResource(r types.Resource, ctx *hcl.EvalContext, b *hclsynta
 	return nil
 }
 
+// addVariable stores a variable block, a variable with the same name replaces
+// the existing block
+func (c *Config) addVariable(b *hclsyntax.Block) {
+	for i, v := range c.variables {
+		if v.Labels[0] == b.Labels[0] {
+			c.variables[i] = b
+			return
+		}
+	}
+
+	c.variables = append(c.variables, b)
+}
+
 func (c *Config) removeResource(rf types.Resource) error {
 	pos := -1
 	for i, r := range c.Resources {
@@ -320,3 +384,149 @@ func (c *Config) getBody(rf types.Resource) (*hclsyntax.Body, error) {
 
 	return nil, ResourceNotFoundError{}
 }
+
+// MarshalJSON serializes the config to JSON, the type of each resource is
+// recorded so that the config can be decoded back into the concrete types.
+// Attributes that have not been decoded by the parser i.e. interface{} values
+// like module variables are serialized using their evaluated value.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	resources := []json.RawMessage{}
+
+	for _, r := range c.Resources {
+		d, err := c.marshalResource(r, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to serialize resource %s: %s", ResourceFQDN{Module: r.Metadata().Module, Type: r.Metadata().Type, Resource: r.Metadata().Name}, err)
+		}
+
+		resources = append(resources, d)
+	}
+
+	return json.Marshal(map[string]interface{}{"resources": resources})
+}
+
+// UnmarshalJSON decodes a config that has been serialized with MarshalJSON,
+// resources are created using the registered types of the parser that created
+// the config. If the config was not created by a parser only the default types
+// can be decoded, use Parser.ParseJSON to decode configs with custom types.
+func (c *Config) UnmarshalJSON(d []byte) error {
+	raw := struct {
+		Resources []json.RawMessage `json:"resources"`
+	}{}
+
+	err := json.Unmarshal(d, &raw)
+	if err != nil {
+		return err
+	}
+
+	rt := c.registeredTypes
+	if rt == nil {
+		rt = types.DefaultTypes()
+	}
+
+	if c.contexts == nil {
+		c.contexts = map[types.Resource]*hcl.EvalContext{}
+		c.bodies = map[types.Resource]*hclsyntax.Body{}
+	}
+
+	c.Resources = []types.Resource{}
+
+	for _, rd := range raw.Resources {
+		meta := types.ResourceMetadata{}
+
+		err := json.Unmarshal(rd, &meta)
+		if err != nil {
+			return fmt.Errorf("unable to decode resource: %s", err)
+		}
+
+		r, err := rt.CreateResource(meta.Type, meta.Name)
+		if err != nil {
+			return fmt.Errorf("unable to create resource %s.%s: %s", meta.Type, meta.Name, err)
+		}
+
+		err = json.Unmarshal(rd, r)
+		if err != nil {
+			return fmt.Errorf("unable to decode resource %s.%s: %s", meta.Type, meta.Name, err)
+		}
+
+		c.Resources = append(c.Resources, r)
+	}
+
+	return nil
+}
+
+// marshalResource serializes a single resource, any interface{} fields that contain
+// unevaluated hcl attributes are replaced with their values. locked should be true
+// when the caller already holds the lock for the resources context.
+func (c *Config) marshalResource(r types.Resource, locked bool) ([]byte, error) {
+	v := reflect.ValueOf(r).Elem()
+
+	// take a shallow copy so that the attributes can be removed
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+
+	values := map[string]json.RawMessage{}
+
+	for i := 0; i < cp.NumField(); i++ {
+		f := cp.Type().Field(i)
+		if f.Type.Kind() != reflect.Interface || !f.IsExported() {
+			continue
+		}
+
+		attr, ok := cp.Field(i).Interface().(*hcl.Attribute)
+		if !ok {
+			continue
+		}
+
+		cp.Field(i).Set(reflect.Zero(f.Type))
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		ctx, _ := c.getContext(r)
+		if ctx == nil {
+			continue
+		}
+
+		var ul func()
+		if !locked {
+			ul = getContextLock(ctx)
+		}
+
+		val, diags := attr.Expr.Value(ctx)
+
+		if ul != nil {
+			ul()
+		}
+
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to evaluate attribute %s: %s", name, diags.Error())
+		}
+
+		d, err := json.Marshal(ctyjson.SimpleJSONValue{Value: val})
+		if err != nil {
+			return nil, err
+		}
+
+		values[name] = d
+	}
+
+	d, err := json.Marshal(cp.Addr().Interface())
+	if err != nil || len(values) == 0 {
+		return d, err
+	}
+
+	// merge the evaluated values
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(d, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range values {
+		fields[k] = v
+	}
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,214 @@
+package hclconfig
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// ConfigFunction defines a function that has read access to the parsed config,
+// the function is created for the root config and each module when the
+// context for the config is built
+type ConfigFunction struct {
+	// Function creates the function for a module, module is the module
+	// of the resources calling the function
+	Function func(c types.ConfigReader, module string) function.Function
+
+	// Dependencies optionally returns the FQDNs of the resources, relative to
+	// module, that must be processed before a resource calling the function.
+	// args contains the arguments that are literal values, other arguments
+	// are unknown
+	Dependencies func(c types.ConfigReader, module string, args []cty.Value) []string
+}
+
+// defaultConfigFunctions are the built in functions that have access to the config
+var defaultConfigFunctions = map[string]ConfigFunction{
+	"resource_exists": {
+		Function:     resourceExistsFunction,
+		Dependencies: resourceExistsDependencies,
+	},
+	"resources_of_type": {
+		Function:     resourcesOfTypeFunction,
+		Dependencies: resourcesOfTypeDependencies,
+	},
+}
+
+// RegisterConfigFunction registers a custom interpolation function that has
+// read access to the config
+func (p *Parser) RegisterConfigFunction(name string, f ConfigFunction, opts ...FunctionOption) error {
+	if f.Function == nil {
+		return fmt.Errorf("unable to register function %s: Function must be set", name)
+	}
+
+	o := &functionOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	name, err := p.functionName(name, o)
+	if err != nil {
+		return err
+	}
+
+	p.configFunctions[name] = f
+	p.impureFunctions[name] = o.impure
+
+	return nil
+}
+
+// allowedConfigFunctions returns the config functions that can be used, built in
+// functions are restricted by the AllowedFunctions option
+func (p *Parser) allowedConfigFunctions() map[string]ConfigFunction {
+	funcs := map[string]ConfigFunction{}
+	for name, f := range defaultConfigFunctions {
+		if len(p.options.AllowedFunctions) == 0 || containsString(p.options.AllowedFunctions, name) {
+			funcs[name] = f
+		}
+	}
+
+	for name, f := range p.configFunctions {
+		funcs[name] = f
+	}
+
+	return funcs
+}
+
+// setConfigFunctionDependencies adds the dependencies for any config functions
+// called by a resource, this needs to be done once all the resources have been
+// parsed and before the graph is built
+func (c *Config) setConfigFunctionDependencies() {
+	for _, r := range c.Resources {
+		b, ok := c.bodies[r]
+		if !ok || b == nil {
+			continue
+		}
+
+		hclsyntax.VisitAll(b, func(n hclsyntax.Node) hcl.Diagnostics {
+			fc, ok := n.(*hclsyntax.FunctionCallExpr)
+			if !ok {
+				return nil
+			}
+
+			f, ok := c.configFunctions[fc.Name]
+			if !ok || f.Dependencies == nil {
+				return nil
+			}
+
+			// only literal arguments can be evaluated before the resource is decoded
+			args := []cty.Value{}
+			for _, a := range fc.Args {
+				v, diags := a.Value(nil)
+				if diags.HasErrors() {
+					v = cty.DynamicVal
+				}
+
+				args = append(args, v)
+			}
+
+			for _, d := range f.Dependencies(c, r.Metadata().Module, args) {
+				dep, err := c.FindRelativeResource(d, r.Metadata().Module)
+				if err != nil || dep == r {
+					continue
+				}
+
+				if !containsString(r.Metadata().DependsOn, d) {
+					r.Metadata().DependsOn = append(r.Metadata().DependsOn, d)
+				}
+			}
+
+			return nil
+		})
+	}
+}
+
+// resourceExistsFunction returns true when the resource exists in the
+// module and is not disabled
+func resourceExistsFunction(c types.ConfigReader, module string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "fqdn",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			r, err := c.FindRelativeResource(args[0].AsString(), module)
+			if err != nil {
+				return cty.False, nil
+			}
+
+			return cty.BoolVal(!r.Metadata().Disabled), nil
+		},
+	})
+}
+
+// resourceExistsDependencies makes the caller depend on the resource so that
+// it has been processed before the caller
+func resourceExistsDependencies(c types.ConfigReader, module string, args []cty.Value) []string {
+	if len(args) != 1 || !args[0].IsKnown() || args[0].Type() != cty.String {
+		return nil
+	}
+
+	return []string{args[0].AsString()}
+}
+
+// resourcesOfTypeFunction returns the names of the resources of the given type in
+// the module, disabled resources are not returned
+func resourcesOfTypeFunction(c types.ConfigReader, module string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "type",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.List(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			// FindResourcesByType returns an error when there are no resources
+			res, _ := c.FindResourcesByType(args[0].AsString())
+
+			names := []cty.Value{}
+			for _, r := range res {
+				if r.Metadata().Module != module || r.Metadata().Disabled {
+					continue
+				}
+
+				names = append(names, cty.StringVal(r.Metadata().Name))
+			}
+
+			if len(names) == 0 {
+				return cty.ListValEmpty(cty.String), nil
+			}
+
+			return cty.ListVal(names), nil
+		},
+	})
+}
+
+// resourcesOfTypeDependencies makes the caller depend on every resource of the
+// type in the module so that they have been processed before the caller
+func resourcesOfTypeDependencies(c types.ConfigReader, module string, args []cty.Value) []string {
+	if len(args) != 1 || !args[0].IsKnown() || args[0].Type() != cty.String {
+		return nil
+	}
+
+	// FindResourcesByType returns an error when there are no resources
+	res, _ := c.FindResourcesByType(args[0].AsString())
+
+	deps := []string{}
+	for _, r := range res {
+		if r.Metadata().Module != module {
+			continue
+		}
+
+		fqdn := ResourceFQDN{Type: r.Metadata().Type, Resource: r.Metadata().Name}
+		deps = append(deps, fqdn.String())
+	}
+
+	return deps
+}
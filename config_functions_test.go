@@ -0,0 +1,228 @@
+package hclconfig
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+var configFunctionsConfig = `
+container "consul" {
+  command = resources_of_type("network")
+
+  env = {
+    "onprem"  = resource_exists("resource.network.onprem")
+    "cloud"   = resource_exists("resource.network.cloud")
+    "missing" = resource_exists("resource.network.missing")
+  }
+}
+
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+network "cloud" {
+  subnet = "10.7.0.0/16"
+  disabled = true
+}
+`
+
+func TestParseProcessesConfigFunctions(t *testing.T) {
+	order := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		order = append(order, resourceFQDN(r))
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, configFunctionsConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, []string{"onprem"}, cont.Command)
+	require.Equal(t, "true", cont.Env["onprem"])
+	require.Equal(t, "false", cont.Env["cloud"])
+	require.Equal(t, "false", cont.Env["missing"])
+
+	// resource_exists adds a dependency on the resource
+	requireBefore(t, "resource.network.onprem", "resource.container.consul", order)
+}
+
+func TestParseProcessesResourcesOfTypeBeforeCaller(t *testing.T) {
+	order := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		order = append(order, resourceFQDN(r))
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, `
+container "consul" {
+  command = resources_of_type("network")
+}
+
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+network "cloud" {
+  subnet = "10.7.0.0/16"
+}
+`), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"onprem", "cloud"}, r.(*structs.Container).Command)
+
+	requireBefore(t, "resource.network.onprem", "resource.container.consul", order)
+	requireBefore(t, "resource.network.cloud", "resource.container.consul", order)
+}
+
+func TestConfigFunctionsAreScopedToTheCallingModule(t *testing.T) {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "main.hcl", `
+network "root" {
+  subnet = "10.6.0.0/16"
+}
+
+module "sub" {
+  source = "./sub"
+}
+`)
+
+	writeTestFile(t, dir, "sub/main.hcl", `
+network "sub" {
+  subnet = "10.7.0.0/16"
+}
+
+container "consul" {
+  command = resources_of_type("network")
+
+  env = {
+    "sub"  = resource_exists("resource.network.sub")
+    "root" = resource_exists("resource.network.root")
+  }
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ParseDirectory(dir, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("module.sub.resource.container.consul")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, []string{"sub"}, cont.Command)
+	require.Equal(t, "true", cont.Env["sub"])
+	require.Equal(t, "false", cont.Env["root"])
+}
+
+func TestConfigFunctionsCanBeCalledWhenParsing(t *testing.T) {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "a_network.hcl", `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+`)
+
+	writeTestFile(t, dir, "b_container.hcl", `
+variable "has_onprem" {
+  default = resource_exists("resource.network.onprem")
+}
+
+container "consul" {
+  env = {
+    "onprem" = var.has_onprem
+  }
+}
+
+container "vault" {
+  disabled = resource_exists("resource.network.onprem")
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ParseDirectory(dir, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, "true", r.(*structs.Container).Env["onprem"])
+
+	r, err = c.FindResource("resource.container.vault")
+	require.NoError(t, err)
+	require.True(t, r.Metadata().Disabled)
+}
+
+func TestParseProcessesCustomConfigFunctions(t *testing.T) {
+	c, p := setupParser(t)
+
+	err := p.RegisterConfigFunction("resource_count", ConfigFunction{
+		Function: func(c types.ConfigReader, module string) function.Function {
+			return function.New(&function.Spec{
+				Type: function.StaticReturnType(cty.Number),
+				Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+					return cty.NumberIntVal(int64(c.ResourceCount())), nil
+				},
+			})
+		},
+	})
+	require.NoError(t, err)
+
+	err = p.ParseFile(CreateTestFile(t, `
+container "consul" {
+  env = {
+    "count" = resource_count()
+  }
+}
+
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+`), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, "2", r.(*structs.Container).Env["count"])
+}
+
+func TestRegisterConfigFunctionWithoutFunctionReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterConfigFunction("invalid", ConfigFunction{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Function must be set")
+}
@@ -1,6 +1,8 @@
 package hclconfig
 
 import (
+	"encoding/json"
+	"path/filepath"
 	"testing"
 
 	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
@@ -257,3 +259,47 @@ func TestFQDNStringWithModuleResourceReturnsCorrectly(t *testing.T) {
 
 	require.Equal(t, "module.module1.module2.resource.container.mine", fqdnStr)
 }
+
+func TestConfigJSONRoundTripCreatesConcreteTypes(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/modules/modules.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	d, err := json.Marshal(c)
+	require.NoError(t, err)
+
+	c2, err := p.ParseJSON(d)
+	require.NoError(t, err)
+	require.Equal(t, c.ResourceCount(), c2.ResourceCount())
+
+	r, err := c2.FindResource("module.consul_1.resource.container.consul")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+	require.Equal(t, "onprem", cont.Networks[0].Name)
+	require.Equal(t, 4096, cont.Resources.CPU)
+
+	r, err = c2.FindResource("resource.output.module1_container_resources_cpu")
+	require.NoError(t, err)
+	require.Equal(t, "4096", r.(*types.Output).Value)
+
+	// module variables are serialized as the evaluated value
+	r, err = c2.FindResource("resource.module.consul_1")
+	require.NoError(t, err)
+	require.Equal(t, float64(4096), r.(*types.Module).Variables.(map[string]interface{})["cpu_resources"])
+}
+
+func TestConfigUnmarshalJSONWithUnknownTypeReturnsError(t *testing.T) {
+	c := testSetupConfig(t)
+
+	d, err := json.Marshal(c)
+	require.NoError(t, err)
+
+	// a config not created by a parser only knows the default types
+	err = json.Unmarshal(d, NewConfig())
+	require.Error(t, err)
+}
@@ -0,0 +1,252 @@
+package hclconfig
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/terraform/dag"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// DependencyKind defines how a dependency between two resources was created
+type DependencyKind string
+
+const (
+	// DependencyExplicit is a dependency defined with depends_on
+	DependencyExplicit DependencyKind = "depends_on"
+	// DependencyLink is a dependency created by referencing an attribute of
+	// another resource i.e. resource.network.onprem.name
+	DependencyLink DependencyKind = "reference"
+	// DependencyModule is the dependency between a resource and the module
+	// that it was loaded from
+	DependencyModule DependencyKind = "module"
+)
+
+// CycleEdge is a single dependency in a cycle, From depends on To
+type CycleEdge struct {
+	From string
+	To   string
+	Kind DependencyKind
+
+	// Reference is the depends_on entry or the reference that created the edge
+	Reference string
+
+	// Range is the location of the reference in the source, nil if the
+	// location is not known
+	Range *hcl.Range
+}
+
+func (e CycleEdge) String() string {
+	s := fmt.Sprintf("%s depends on %s", e.From, e.To)
+
+	switch e.Kind {
+	case DependencyModule:
+		s += " as it is defined in the module"
+	case DependencyExplicit:
+		s += fmt.Sprintf(" via depends_on %q", e.Reference)
+	default:
+		s += fmt.Sprintf(" via reference %s", e.Reference)
+	}
+
+	if e.Range != nil {
+		s += fmt.Sprintf(" at %s", e.Range)
+	}
+
+	return s
+}
+
+// CycleError is returned when the dependencies of resources form a cycle,
+// each cycle is an ordered chain of edges where the last edge leads back to
+// the first resource
+type CycleError struct {
+	Cycles [][]CycleEdge
+}
+
+func (e *CycleError) Error() string {
+	sb := strings.Builder{}
+
+	for i, c := range e.Cycles {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		chain := []string{}
+		for _, edge := range c {
+			chain = append(chain, edge.From)
+		}
+
+		chain = append(chain, c[0].From)
+
+		fmt.Fprintf(&sb, "dependency cycle: %s", strings.Join(chain, " -> "))
+
+		for _, edge := range c {
+			fmt.Fprintf(&sb, "\n  %s", edge)
+		}
+	}
+
+	return sb.String()
+}
+
+// findCycles returns a CycleError if the graph contains any cycles
+func (c *Config) findCycles(g *dag.AcyclicGraph) error {
+	cycles := [][]CycleEdge{}
+
+	// resources that depend on themselves
+	for _, r := range c.Resources {
+		if g.HasEdge(dag.BasicEdge(r, r)) {
+			cycles = append(cycles, []CycleEdge{c.cycleEdge(r, r)})
+		}
+	}
+
+	for _, scc := range g.Cycles() {
+		members := map[types.Resource]bool{}
+		for _, v := range scc {
+			members[v.(types.Resource)] = true
+		}
+
+		// start the chain at the first resource defined in the config
+		// so that the error is stable
+		var start types.Resource
+		for _, r := range c.Resources {
+			if members[r] {
+				start = r
+				break
+			}
+		}
+
+		path := c.cyclePath(g, start, start, members, map[types.Resource]bool{})
+
+		edges := []CycleEdge{}
+		for i := range path {
+			edges = append(edges, c.cycleEdge(path[i], path[(i+1)%len(path)]))
+		}
+
+		cycles = append(cycles, edges)
+	}
+
+	if len(cycles) == 0 {
+		return nil
+	}
+
+	return &CycleError{Cycles: cycles}
+}
+
+// cyclePath returns the resources on a path from r back to start, only
+// resources in the strongly connected component members are followed
+func (c *Config) cyclePath(g *dag.AcyclicGraph, r, start types.Resource, members, visited map[types.Resource]bool) []types.Resource {
+	visited[r] = true
+
+	// follow the dependencies in config order
+	deps := g.UpEdges(r)
+	for _, d := range c.Resources {
+		if !deps.Include(d) || !members[d] {
+			continue
+		}
+
+		if d == start {
+			return []types.Resource{r}
+		}
+
+		if visited[d] {
+			continue
+		}
+
+		if p := c.cyclePath(g, d, start, members, visited); p != nil {
+			return append([]types.Resource{r}, p...)
+		}
+	}
+
+	return nil
+}
+
+// cycleEdge returns how the dependency between from and to was created
+func (c *Config) cycleEdge(from, to types.Resource) CycleEdge {
+	edge := CycleEdge{From: resourceFQDN(from), To: resourceFQDN(to), Kind: DependencyModule}
+	body, _ := c.getBody(from)
+
+	// links to attributes of other resources
+	for _, l := range from.Metadata().ResourceLinks {
+		r, err := c.FindRelativeResource(l, from.Metadata().Module)
+		if err != nil || r != to {
+			continue
+		}
+
+		edge.Kind = DependencyLink
+		edge.Reference = l
+		edge.Range = findReferenceRange(body, l)
+
+		return edge
+	}
+
+	// explicit dependencies
+	for _, d := range from.Metadata().DependsOn {
+		if containsString(from.Metadata().ResourceLinks, d) || !c.dependsOnResource(from, d, to) {
+			continue
+		}
+
+		edge.Kind = DependencyExplicit
+		edge.Reference = d
+
+		if body != nil {
+			if a, ok := body.Attributes["depends_on"]; ok {
+				rng := a.Expr.Range()
+				edge.Range = &rng
+			}
+		}
+
+		return edge
+	}
+
+	return edge
+}
+
+// dependsOnResource returns true if the depends_on entry d of resource
+// from resolves to the resource to
+func (c *Config) dependsOnResource(from types.Resource, d string, to types.Resource) bool {
+	fqdn, err := ParseFQDN(d)
+	if err != nil {
+		return false
+	}
+
+	if fqdn.Resource != "" {
+		r, err := c.FindRelativeResource(d, from.Metadata().Module)
+		return err == nil && r == to
+	}
+
+	deps, _ := c.FindRelativeModuleResources(fqdn.Module, from.Metadata().Module, true)
+	for _, r := range deps {
+		if r == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findReferenceRange returns the location of the first reference to link in the body
+func findReferenceRange(body *hclsyntax.Body, link string) *hcl.Range {
+	if body == nil {
+		return nil
+	}
+
+	var rng *hcl.Range
+
+	hclsyntax.VisitAll(body, func(n hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || rng != nil {
+			return nil
+		}
+
+		ref, err := processScopeTraversal(expr)
+		if err == nil && ref == link {
+			r := expr.Range()
+			rng = &r
+		}
+
+		return nil
+	})
+
+	return rng
+}
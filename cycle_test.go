@@ -0,0 +1,152 @@
+package hclconfig
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+var cycleConfig = `
+container "a" {
+  dns = ["1.1.1.1"]
+
+  network {
+    name = resource.network.b.subnet
+  }
+}
+
+network "b" {
+  subnet     = "10.6.0.0/16"
+  depends_on = ["resource.container.c"]
+}
+
+container "c" {
+  dns = resource.container.a.dns
+}
+`
+
+func TestParseWithCycleReturnsCycleError(t *testing.T) {
+	c, p := setupParser(t)
+
+	file := CreateTestFile(t, cycleConfig)
+	err := p.ParseFile(file, c)
+	require.Error(t, err)
+
+	ce := &CycleError{}
+	require.True(t, errors.As(err, &ce))
+	require.Len(t, ce.Cycles, 1)
+
+	cycle := ce.Cycles[0]
+	require.Len(t, cycle, 3)
+
+	require.Equal(t, "resource.container.a", cycle[0].From)
+	require.Equal(t, "resource.network.b", cycle[0].To)
+	require.Equal(t, DependencyLink, cycle[0].Kind)
+	require.Equal(t, "resource.network.b.subnet", cycle[0].Reference)
+	require.Equal(t, file, cycle[0].Range.Filename)
+	require.Equal(t, 6, cycle[0].Range.Start.Line)
+
+	require.Equal(t, "resource.network.b", cycle[1].From)
+	require.Equal(t, "resource.container.c", cycle[1].To)
+	require.Equal(t, DependencyExplicit, cycle[1].Kind)
+	require.Equal(t, 12, cycle[1].Range.Start.Line)
+
+	require.Equal(t, "resource.container.c", cycle[2].From)
+	require.Equal(t, "resource.container.a", cycle[2].To)
+	require.Equal(t, DependencyLink, cycle[2].Kind)
+
+	require.Contains(t, err.Error(), "dependency cycle: resource.container.a -> resource.network.b -> resource.container.c -> resource.container.a")
+}
+
+func TestParseWithSelfReferenceReturnsCycleError(t *testing.T) {
+	c, p := setupParser(t)
+
+	err := p.ParseFile(CreateTestFile(t, `
+container "a" {
+  command = ["a"]
+  dns = resource.container.a.command
+}
+`), c)
+	require.Error(t, err)
+
+	ce := &CycleError{}
+	require.True(t, errors.As(err, &ce))
+	require.Len(t, ce.Cycles, 1)
+	require.Len(t, ce.Cycles[0], 1)
+	require.Equal(t, "resource.container.a", ce.Cycles[0][0].To)
+}
+
+func setupDependsOnModule(t *testing.T, config string) (string, *[]string, *Parser) {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "main.hcl", config)
+	writeTestFile(t, dir, "sub/main.hcl", `
+container "sub" {
+  command = ["sub"]
+}
+`)
+
+	order := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		order = append(order, resourceFQDN(r))
+		return nil
+	}
+
+	_, p := setupParser(t, o)
+
+	return dir, &order, p
+}
+
+func TestParseWithDependsOnProcessesDependenciesFirst(t *testing.T) {
+	dir, order, p := setupDependsOnModule(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "consul" {
+  depends_on = ["resource.network.onprem"]
+}
+
+module "sub" {
+  source     = "./sub"
+  depends_on = ["resource.container.consul"]
+}
+`)
+
+	err := p.ParseDirectory(dir, NewConfig())
+	require.NoError(t, err)
+
+	requireBefore(t, "resource.network.onprem", "resource.container.consul", *order)
+	requireBefore(t, "resource.container.consul", "resource.module.sub", *order)
+	requireBefore(t, "resource.container.consul", "module.sub.resource.container.sub", *order)
+}
+
+func TestParseWithModuleDependsOnCycleReturnsCycleError(t *testing.T) {
+	dir, _, p := setupDependsOnModule(t, `
+container "consul" {
+  depends_on = ["resource.module.sub"]
+}
+
+module "sub" {
+  source     = "./sub"
+  depends_on = ["resource.container.consul"]
+}
+`)
+
+	err := p.ParseDirectory(dir, NewConfig())
+	require.Error(t, err)
+
+	ce := &CycleError{}
+	require.True(t, errors.As(err, &ce))
+	require.Contains(t, err.Error(), "module.sub")
+}
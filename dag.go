@@ -1,14 +1,18 @@
 package hclconfig
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl2/gohcl"
 	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
 	"github.com/hashicorp/terraform/dag"
 	"github.com/hashicorp/terraform/tfdiags"
 	"github.com/shipyard-run/hclconfig/lookup"
@@ -44,8 +48,11 @@ func doYaLikeDAGs(c *Config) (*dag.AcyclicGraph, error) {
 		// add links to dependencies
 		// this is here for now as we might need to process these two
 		// lists separately
+		// the graph can be built multiple times, only add the links once
 		for _, v := range resource.Metadata().ResourceLinks {
-			resource.Metadata().DependsOn = append(resource.Metadata().DependsOn, v)
+			if !containsString(resource.Metadata().DependsOn, v) {
+				resource.Metadata().DependsOn = append(resource.Metadata().DependsOn, v)
+			}
 		}
 
 		// use a map to keep a unique list
@@ -118,16 +125,219 @@ func doYaLikeDAGs(c *Config) (*dag.AcyclicGraph, error) {
 // ProcessCallback is called with the resource when the graph processes that particular node
 type ProcessCallback func(r types.Resource) error
 
+// WalkDirection defines the order that resources are visited when walking the graph
+type WalkDirection int
+
+const (
+	// WalkForward visits resources after their dependencies
+	WalkForward WalkDirection = iota
+	// WalkReverse visits resources before their dependencies i.e. for teardown,
+	// containers are visited before the networks they are attached to and
+	// resources in a module are visited before the module
+	WalkReverse
+)
+
+// ProcessCallbackWithContext is the context aware version of ProcessCallback, ctx is
+// the context passed to ParseFileWithContext or ParseDirectoryWithContext
+type ProcessCallbackWithContext func(ctx context.Context, r types.Resource) error
+
+// validate decodes the resources in dependency order without processing them,
+// Process is not called and the resources are not finalized
+func (c *Config) validate(ctx context.Context) error {
+	c.validating = true
+	defer func() { c.validating = false }()
+
+	return c.walk(ctx, c.createCallback(ctx, nil), WalkForward, 0)
+}
+
 // Until parse is called the HCL configuration is not deserialized into
 // the structs. We have to do this using a graph as some inputs depend on
 // outputs from other resrouces, therefore we need to process this is strict order
-func (c *Config) process(wf ProcessCallback) error {
+func (c *Config) process(ctx context.Context, wf ProcessCallbackWithContext, maxConcurrency int) error {
+	err := c.walk(ctx, c.createCallback(ctx, wf), WalkForward, maxConcurrency)
+	if err != nil {
+		return err
+	}
+
+	return c.finalize()
+}
+
+// finalize calls Finalize on every processed resource that implements
+// types.Finalizer once the graph has been walked
+func (c *Config) finalize() error {
+	for _, r := range c.Resources {
+		f, ok := r.(types.Finalizer)
+		if !ok || r.Metadata().Disabled || !c.isTargeted(r) {
+			continue
+		}
+
+		err := f.Finalize(c)
+		if err != nil {
+			return fmt.Errorf("error calling finalize for resource: %s, %s", resourceFQDN(r), err)
+		}
+	}
+
+	return nil
+}
+
+// Walk visits every resource in the config in dependency order calling the
+// callback for each resource, independent resources are visited in parallel.
+// Unlike parsing, resources are not decoded, Walk can be used with configs that
+// have been parsed or decoded from JSON. Disabled resources are skipped.
+//
+// When direction is WalkReverse, resources that implement types.Destroyable
+// have their Destroy method called before the callback.
+func (c *Config) Walk(wf ProcessCallback, direction WalkDirection) error {
+	var cb ProcessCallbackWithContext
+	if wf != nil {
+		cb = func(ctx context.Context, r types.Resource) error {
+			return wf(r)
+		}
+	}
+
+	return c.WalkWithContext(context.Background(), cb, direction, 0)
+}
+
+// WalkWithContext is the context aware version of Walk, no new resources are visited
+// once ctx is cancelled. maxConcurrency limits the number of resources that are
+// visited in parallel, when 0 there is no limit.
+func (c *Config) WalkWithContext(ctx context.Context, wf ProcessCallbackWithContext, direction WalkDirection, maxConcurrency int) error {
+	return c.walk(ctx, func(v dag.Vertex) (diags tfdiags.Diagnostics) {
+		r := v.(types.Resource)
+
+		if isRootModule(r) || r.Metadata().Disabled {
+			return nil
+		}
+
+		fqdn := &ResourceFQDN{Module: r.Metadata().Module, Type: r.Metadata().Type, Resource: r.Metadata().Name}
+
+		if direction == WalkReverse {
+			var err error
+
+			switch d := r.(type) {
+			case types.DestroyableWithContext:
+				err = d.DestroyWithContext(ctx)
+			case types.Destroyable:
+				err = d.Destroy()
+			}
+
+			if err != nil {
+				return diags.Append(fmt.Errorf("error calling destroy for resource: %s, %s", fqdn, err))
+			}
+		}
+
+		if wf != nil {
+			err := wf(ctx, r)
+			if err != nil {
+				return diags.Append(fmt.Errorf("error processing graph node: %s, %s", fqdn, err))
+			}
+		}
+
+		return nil
+	}, direction, maxConcurrency)
+}
+
+// setTargets limits processing to the resources with the given FQDNs and their
+// transitive dependencies, when includeDependents is true the resources that
+// depend on the targets are also processed. Targets can be resources or modules,
+// targeting a module targets all the resources in the module.
+func (c *Config) setTargets(targets []string, includeDependents bool) error {
+	g, err := doYaLikeDAGs(c)
+	if err != nil {
+		return fmt.Errorf("unable to create graph: %s", err)
+	}
+
+	resolved := map[types.Resource]bool{}
+
+	for _, t := range targets {
+		fqdn, err := ParseFQDN(t)
+		if err != nil {
+			return fmt.Errorf("invalid target %s: %s", t, err)
+		}
+
+		matches := []types.Resource{}
+
+		if fqdn.Resource == "" {
+			// target is a module, add the module and all resources in the module
+			mod, err := c.FindResource(ResourceFQDN{Module: parentModule(fqdn.Module), Type: types.TypeModule, Resource: moduleName(fqdn.Module)}.String())
+			if err != nil {
+				return fmt.Errorf("unable to find target %s: %s", t, err)
+			}
+
+			children, _ := c.FindModuleResources(t, true)
+			matches = append(append(matches, mod), children...)
+		} else {
+			r, err := c.FindResource(t)
+			if err != nil {
+				return fmt.Errorf("unable to find target %s: %s", t, err)
+			}
+
+			matches = append(matches, r)
+		}
+
+		for _, r := range matches {
+			resolved[r] = true
+
+			deps, err := g.Descendents(r)
+			if err != nil {
+				return err
+			}
+
+			for _, d := range deps.List() {
+				resolved[d.(types.Resource)] = true
+			}
+
+			if !includeDependents {
+				continue
+			}
+
+			dependents, err := g.Ancestors(r)
+			if err != nil {
+				return err
+			}
+
+			for _, d := range dependents.List() {
+				resolved[d.(types.Resource)] = true
+			}
+		}
+	}
+
+	c.targets = resolved
+
+	return nil
+}
+
+// isTargeted returns true if the resource should be processed
+func (c *Config) isTargeted(r types.Resource) bool {
+	return c.targets == nil || c.targets[r]
+}
+
+// moduleName returns the name of the module from a module path i.e. module1.module2
+func moduleName(path string) string {
+	parts := strings.Split(path, ".")
+	return parts[len(parts)-1]
+}
+
+// parentModule returns the path of the parent module from a module path i.e. module1.module2
+func parentModule(path string) string {
+	parts := strings.Split(path, ".")
+	return strings.Join(parts[:len(parts)-1], ".")
+}
+
+func (c *Config) walk(ctx context.Context, cb dag.WalkFunc, direction WalkDirection, maxConcurrency int) error {
 	// build the graph
 	d, err := doYaLikeDAGs(c)
 	if err != nil {
 		return fmt.Errorf("unable to create graph: %s", err)
 	}
 
+	// check for cycles before the graph is reduced so that every
+	// dependency in the cycle is reported
+	err = c.findCycles(d)
+	if err != nil {
+		return fmt.Errorf("Unable to validate dependency graph: %w", err)
+	}
+
 	// reduce the graph nodes to unique instances
 	d.TransitiveReduction()
 
@@ -137,15 +347,49 @@ func (c *Config) process(wf ProcessCallback) error {
 		return fmt.Errorf("Unable to validate dependency graph: %w", err)
 	}
 
+	// the walker starts every node that has its dependencies met, use a
+	// semaphore to limit the number of nodes that are processed at once
+	var sem chan struct{}
+	if maxConcurrency > 0 {
+		sem = make(chan struct{}, maxConcurrency)
+	}
+
 	// define the walker callback that will be called for every node in the graph
-	w := dag.Walker{}
-	w.Callback = c.createCallback(wf)
+	w := dag.Walker{Reverse: direction == WalkReverse}
+	w.Callback = func(v dag.Vertex) (diags tfdiags.Diagnostics) {
+		if r := v.(types.Resource); !isRootModule(r) {
+			c.emit(EventScheduled, r, time.Time{}, nil)
+		}
+
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return diags.Append(ctx.Err())
+			}
+		}
+
+		// do not start any new nodes once cancelled, nodes that depend on
+		// this node will not be processed as it has failed
+		if ctx.Err() != nil {
+			return diags.Append(ctx.Err())
+		}
+
+		return cb(v)
+	}
 
 	// update the dag and process the nodes
 	log.SetOutput(ioutil.Discard)
 
 	w.Update(d)
 	diags := w.Wait()
+	c.warnings = diags
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("processing cancelled: %w", ctx.Err())
+	}
+
 	if diags.HasErrors() {
 		err := diags.Err()
 		return err
@@ -154,7 +398,9 @@ func (c *Config) process(wf ProcessCallback) error {
 	return nil
 }
 
-func (c *Config) createCallback(wf ProcessCallback) func(v dag.Vertex) (diags tfdiags.Diagnostics) {
+// createCallback returns the walk function that decodes and processes each resource,
+// processCtx is passed to the context aware process methods and callbacks
+func (c *Config) createCallback(processCtx context.Context, wf ProcessCallbackWithContext) func(v dag.Vertex) (diags tfdiags.Diagnostics) {
 	return func(v dag.Vertex) (diags tfdiags.Diagnostics) {
 
 		r, ok := v.(types.Resource)
@@ -163,11 +409,28 @@ func (c *Config) createCallback(wf ProcessCallback) func(v dag.Vertex) (diags tf
 			panic("an item has been added to the graph that is not a resource")
 		}
 
-		// if this is the root module or is disabled skip
-		if (r.Metadata().Name == "root" && r.Metadata().Module == "" && r.Metadata().Type == types.TypeModule) || r.Metadata().Disabled {
+		// if this is the root module skip
+		if isRootModule(r) {
+			return nil
+		}
+
+		if r.Metadata().Disabled {
+			c.emit(EventSkippedDisabled, r, time.Time{}, nil)
+			return nil
+		}
+
+		// resources that have not been targeted are not decoded or processed
+		if !c.isTargeted(r) {
 			return nil
 		}
 
+		scheduled := time.Now()
+		defer func() {
+			if diags.HasErrors() {
+				c.emit(EventFailed, r, scheduled, diags.Err())
+			}
+		}()
+
 		bdy, err := c.getBody(r)
 		if err != nil {
 			panic("no body found for resource")
@@ -178,6 +441,9 @@ func (c *Config) createCallback(wf ProcessCallback) func(v dag.Vertex) (diags tf
 			panic("no context found for resource")
 		}
 
+		decodeStart := time.Now()
+		c.emit(EventDecodeStarted, r, time.Time{}, nil)
+
 		// attempt to set the values in the resource links to the resource attribute
 		// all linked values should now have been processed as the graph
 		// will have handled them first
@@ -257,27 +523,96 @@ func (c *Config) createCallback(wf ProcessCallback) func(v dag.Vertex) (diags tf
 		ul := getContextLock(ctx)
 		defer ul()
 
+		clear := c.env.setResource(ctx, r)
+		defer clear()
+
+		// environment variables read to set the variables the resource references
+		c.env.recordReferences(ctx, bdy)
+
 		diag := gohcl.DecodeBody(bdy, ctx, r)
 		if diag.HasErrors() {
+			c.emit(EventDecodeFinished, r, decodeStart, diag)
 			return appendDiagnostic(diags, diag)
 		}
 
-		// if the config implements the processable interface call the resource process method
-		if p, ok := r.(types.Processable); ok {
-			err := p.Process()
+		c.emit(EventDecodeFinished, r, decodeStart, nil)
+
+		fqdn := &ResourceFQDN{Module: r.Metadata().Module, Type: r.Metadata().Type, Resource: r.Metadata().Name}
+
+		if d, ok := r.(types.Defaulter); ok {
+			err := d.SetDefaults()
 			if err != nil {
-				fqdn := &ResourceFQDN{Module: r.Metadata().Module, Type: r.Metadata().Type, Resource: r.Metadata().Name}
-				return diags.Append(fmt.Errorf("error calling process for resource: %s, %s", fqdn, err))
+				return diags.Append(fmt.Errorf("error setting defaults for resource: %s, %s", fqdn, err))
 			}
 		}
+
+		if v, ok := r.(types.Validator); ok {
+			diags = appendValidationDiagnostics(diags, v.Validate(), bdy)
+
+			if diags.HasErrors() {
+				return diags
+			}
+		}
+
+		// the lifecycle block has been decoded, get the retries and timeout
+		policy, err := c.retryPolicy(r)
+		if err != nil {
+			return diags.Append(fmt.Errorf("error in lifecycle for resource: %s, %s", fqdn, err))
+		}
+
+		// if the config implements the processable interface call the resource process method
+		var process func(ctx context.Context) error
+		switch p := r.(type) {
+		case types.ProcessableWithContext:
+			process = p.ProcessWithContext
+		case types.Processable:
+			process = func(context.Context) error { return p.Process() }
+		}
+
+		if c.validating {
+			process = nil
+		}
+
+		if process != nil {
+			processStart := time.Now()
+			c.emit(EventProcessStarted, r, time.Time{}, nil)
+
+			var warnings tfdiags.Diagnostics
+			warnings, err = c.runWithPolicy(processCtx, r, policy, "process", process)
+			diags = diags.Append(warnings)
+
+			c.emit(EventProcessFinished, r, processStart, err)
+		}
+
+		if err != nil {
+			return diags.Append(fmt.Errorf("error calling process for resource: %s, %s", fqdn, err))
+		}
 		//err := r.Process()
 		//if err != nil {
 		//	return diags.Append(fmt.Errorf("error calling process for resource: %s", err))
 		//}
 
+		// record the hash of the decoded resource so that changes can be detected
+		if c.states != nil {
+			hash, err := c.hashResource(r)
+			if err != nil {
+				return diags.Append(fmt.Errorf("unable to create hash for resource: %s, %s", fqdn, err))
+			}
+
+			c.states.record(r, hash)
+		}
+
 		// call the callbacks
 		if wf != nil {
-			err := wf(r)
+			callbackStart := time.Now()
+
+			warnings, err := c.runWithPolicy(processCtx, r, policy, "callback", func(ctx context.Context) error {
+				return wf(ctx, r)
+			})
+			diags = diags.Append(warnings)
+
+			c.emit(EventCallbackFinished, r, callbackStart, err)
+
 			if err != nil {
 				return diags.Append(fmt.Errorf("error processing graph node: %s", err))
 			}
@@ -290,19 +625,35 @@ func (c *Config) createCallback(wf ProcessCallback) func(v dag.Vertex) (diags tf
 
 			var mapVars map[string]cty.Value
 			if att, ok := mod.Variables.(*hcl.Attribute); ok {
-				val, _ := att.Expr.Value(ctx)
+				val, env := c.env.evaluateInputs(ctx, att.Expr)
 				mapVars = val.AsValueMap()
 
 				for k, v := range mapVars {
 					setContextVariable(mod.SubContext, k, v)
+					c.env.setVariable(mod.SubContext, k, env[k])
 				}
 			}
 		}
 
-		return nil
+		return diags
 	}
 }
 
+// isRootModule returns true if the resource is the root node added to the graph
+func isRootModule(r types.Resource) bool {
+	return r.Metadata().Name == "root" && r.Metadata().Module == "" && r.Metadata().Type == types.TypeModule
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 func appendDiagnostic(tf tfdiags.Diagnostics, diags hcl.Diagnostics) tfdiags.Diagnostics {
 	for _, d := range diags {
 		tf = tf.Append(d)
@@ -310,3 +661,60 @@ func appendDiagnostic(tf tfdiags.Diagnostics, diags hcl.Diagnostics) tfdiags.Dia
 
 	return tf
 }
+
+// appendValidationDiagnostics appends the diagnostics returned by a Validator,
+// tfdiags does not recognise hcl2 diagnostics so the message is built using the
+// same format as the decode errors. Diagnostics without a Subject are reported
+// at the range of their Attribute or at the resource body
+func appendValidationDiagnostics(tf tfdiags.Diagnostics, diags types.AttributeDiagnostics, b *hclsyntax.Body) tfdiags.Diagnostics {
+	for _, d := range diags {
+		subject := b.SrcRange
+		if d.Subject != nil {
+			subject = *d.Subject
+		} else if d.Attribute != "" {
+			if rng, ok := attributeRange(b, d.Attribute); ok {
+				subject = rng
+			}
+		}
+
+		msg := fmt.Sprintf("%s: %s; %s", subject, d.Summary, d.Detail)
+
+		if d.Severity == hcl.DiagWarning {
+			tf = tf.Append(tfdiags.SimpleWarning(msg))
+			continue
+		}
+
+		tf = tf.Append(errors.New(msg))
+	}
+
+	return tf
+}
+
+// attributeRange returns the range of the attribute with the given name, attributes
+// in nested blocks are separated by a "."
+func attributeRange(b *hclsyntax.Body, name string) (hcl.Range, bool) {
+	parts := strings.Split(name, ".")
+
+	for _, p := range parts[:len(parts)-1] {
+		var found *hclsyntax.Block
+		for _, blk := range b.Blocks {
+			if blk.Type == p {
+				found = blk
+				break
+			}
+		}
+
+		if found == nil {
+			return hcl.Range{}, false
+		}
+
+		b = found.Body
+	}
+
+	a, ok := b.Attributes[parts[len(parts)-1]]
+	if !ok {
+		return hcl.Range{}, false
+	}
+
+	return a.SrcRange, true
+}
@@ -1,10 +1,14 @@
 package hclconfig
 
 import (
+	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
 
+	"github.com/hashicorp/hcl2/hcl"
 	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/shipyard-run/hclconfig/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -63,3 +67,241 @@ func TestDoYaLikeDAGAddsDependencies(t *testing.T) {
 	require.Contains(t, list, base)
 	require.Contains(t, list, template)
 }
+
+type testDestroyable struct {
+	types.ResourceMetadata `hcl:",remain"`
+
+	destroyed bool
+}
+
+func (d *testDestroyable) Destroy() error {
+	d.destroyed = true
+	return nil
+}
+
+// walkOrder walks the config and returns the position that each resource was visited
+func walkOrder(t *testing.T, c *Config, direction WalkDirection) map[string]int {
+	order := map[string]int{}
+	mutex := sync.Mutex{}
+
+	err := c.Walk(func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		order[resourceFQDN(r)] = len(order)
+		return nil
+	}, direction)
+	require.NoError(t, err)
+
+	return order
+}
+
+func TestWalkReverseVisitsDependentsFirst(t *testing.T) {
+	c := setupGraphConfig(t)
+
+	order := walkOrder(t, c, WalkForward)
+	require.Less(t, order["resource.network.onprem"], order["resource.container.consul"])
+
+	order = walkOrder(t, c, WalkReverse)
+	require.Less(t, order["resource.container.consul"], order["resource.network.onprem"])
+	require.Less(t, order["resource.container.consul"], order["resource.template.consul_config"])
+}
+
+func TestWalkReverseVisitsModuleResourcesBeforeModule(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/modules/modules.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	order := walkOrder(t, c, WalkReverse)
+	require.Less(t, order["module.consul_1.resource.container.consul"], order["resource.module.consul_1"])
+	require.Less(t, order["module.consul_1.resource.network.onprem"], order["resource.module.consul_1"])
+	require.Less(t, order["resource.module.consul_1"], order["resource.container.base"])
+}
+
+func TestWalkReverseCallsDestroy(t *testing.T) {
+	typs := types.DefaultTypes()
+	typs["destroyable"] = &testDestroyable{}
+
+	net, _ := typs.CreateResource("destroyable", "network")
+	cont, _ := typs.CreateResource("destroyable", "container")
+	cont.Metadata().DependsOn = []string{"resource.destroyable.network"}
+
+	// configs that have not been parsed have no bodies or contexts
+	c := NewConfig()
+	c.addResource(net, nil, nil)
+	c.addResource(cont, nil, nil)
+
+	order := walkOrder(t, c, WalkReverse)
+	require.Less(t, order["resource.destroyable.container"], order["resource.destroyable.network"])
+
+	require.True(t, net.(*testDestroyable).destroyed)
+	require.True(t, cont.(*testDestroyable).destroyed)
+}
+
+func TestWalkForwardDoesNotCallDestroy(t *testing.T) {
+	typs := types.DefaultTypes()
+	typs["destroyable"] = &testDestroyable{}
+
+	net, _ := typs.CreateResource("destroyable", "network")
+
+	c := NewConfig()
+	c.addResource(net, nil, nil)
+
+	walkOrder(t, c, WalkForward)
+	require.False(t, net.(*testDestroyable).destroyed)
+}
+
+type testLifecycle struct {
+	types.ResourceMetadata `hcl:",remain"`
+
+	Port     int    `hcl:"port,optional"`
+	Protocol string `hcl:"protocol,optional"`
+
+	// Total is set by Finalize to the number of lifecycle resources in the config
+	Total int `hcl:"total,optional"`
+}
+
+func (l *testLifecycle) SetDefaults() error {
+	if l.Protocol == "" {
+		l.Protocol = "tcp"
+	}
+
+	return nil
+}
+
+func (l *testLifecycle) Validate() types.AttributeDiagnostics {
+	diags := types.AttributeDiagnostics{}
+
+	if l.Port > 65535 {
+		diags = append(diags, types.AttributeDiagnostic{
+			Attribute: "port",
+			Diagnostic: &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid port",
+				Detail:   fmt.Sprintf("port %d must be less than 65536", l.Port),
+			},
+		})
+	}
+
+	if l.Port == 0 {
+		diags = append(diags, types.AttributeDiagnostic{
+			Diagnostic: &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "No port",
+				Detail:   "a random port will be used",
+			},
+		})
+	}
+
+	return diags
+}
+
+func (l *testLifecycle) Finalize(c types.ConfigReader) error {
+	r, err := c.FindResourcesByType("lifecycle")
+	if err != nil {
+		return err
+	}
+
+	l.Total = len(r)
+	return nil
+}
+
+func parseLifecycle(t *testing.T, config string, cb ProcessCallback) (*Config, error) {
+	o := DefaultOptions()
+	o.Callback = cb
+
+	c, p := setupParser(t, o)
+	p.RegisterType("lifecycle", &testLifecycle{})
+
+	err := p.ParseFile(CreateTestFile(t, config), c)
+	return c, err
+}
+
+func TestParseCallsSetDefaultsBeforeProcessing(t *testing.T) {
+	protocol := ""
+
+	c, err := parseLifecycle(t, `
+lifecycle "web" {
+  port = 80
+}
+`, func(r types.Resource) error {
+		protocol = r.(*testLifecycle).Protocol
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "tcp", protocol)
+
+	r, err := c.FindResource("resource.lifecycle.web")
+	require.NoError(t, err)
+	require.Equal(t, "tcp", r.(*testLifecycle).Protocol)
+}
+
+func TestParseReturnsValidationErrors(t *testing.T) {
+	called := false
+
+	_, err := parseLifecycle(t, `
+lifecycle "web" {
+  port = 80000
+}
+`, func(r types.Resource) error {
+		called = true
+		return nil
+	})
+	require.Error(t, err)
+
+	require.Contains(t, err.Error(), "Invalid port; port 80000 must be less than 65536")
+	require.False(t, called)
+}
+
+func TestParseReturnsValidationErrorsAtAttributeRange(t *testing.T) {
+	_, err := parseLifecycle(t, `
+lifecycle "web" {
+  protocol = "udp"
+  port     = 80000
+}
+`, nil)
+	require.Error(t, err)
+
+	require.Contains(t, err.Error(), ".hcl:4,3-19: Invalid port; port 80000 must be less than 65536")
+}
+
+func TestParseReturnsValidationWarnings(t *testing.T) {
+	c, err := parseLifecycle(t, `
+lifecycle "web" {
+}
+`, nil)
+	require.NoError(t, err)
+
+	require.Len(t, c.Warnings(), 1)
+	require.Contains(t, c.Warnings()[0], ".hcl:2,17-3,2: No port; a random port will be used")
+}
+
+func TestParseCallsFinalizeAfterAllResourcesProcessed(t *testing.T) {
+	c, err := parseLifecycle(t, `
+lifecycle "web" {
+  port = 80
+}
+
+lifecycle "api" {
+  port = 8080
+}
+
+lifecycle "disabled" {
+  disabled = true
+}
+`, nil)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.lifecycle.web")
+	require.NoError(t, err)
+	require.Equal(t, 3, r.(*testLifecycle).Total)
+
+	r, err = c.FindResource("resource.lifecycle.disabled")
+	require.NoError(t, err)
+	require.Equal(t, 0, r.(*testLifecycle).Total)
+}
@@ -0,0 +1,405 @@
+package hclconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ChangeType defines the type of change for a resource
+type ChangeType string
+
+const (
+	// ChangeCreate is a resource that exists in the new config but not in the old
+	ChangeCreate ChangeType = "create"
+	// ChangeDelete is a resource that exists in the old config but not in the new
+	ChangeDelete ChangeType = "delete"
+	// ChangeUpdate is a resource that exists in both configs with different attributes
+	ChangeUpdate ChangeType = "update"
+)
+
+// AttributeChange is the before and after value of a changed attribute,
+// values are the JSON representation of the attribute i.e. numbers are float64
+// and blocks are map[string]interface{}
+type AttributeChange struct {
+	// Name of the attribute taken from the hcl tag, or the json tag if the
+	// field has no hcl tag
+	Name   string
+	Before interface{}
+	After  interface{}
+
+	// Upstream is true when the expression that defines the attribute has
+	// not been edited, the value has changed because a linked resource or
+	// a variable, i.e. a module variable set by the parent, has changed
+	Upstream bool
+}
+
+// ResourceChange defines a resource that has been created, deleted or updated
+type ResourceChange struct {
+	// FQDN of the resource i.e. module.consul.resource.container.base
+	FQDN   string
+	Change ChangeType
+
+	// Before is the resource in the old config, nil for created resources
+	Before types.Resource
+	// After is the resource in the new config, nil for deleted resources
+	After types.Resource
+
+	// Attributes that have changed, sorted by name, only set for updated resources
+	Attributes []AttributeChange
+}
+
+// Upstream returns true when all the changed attributes of a resource are the
+// result of changes to linked resources or variables rather than direct edits
+func (r *ResourceChange) Upstream() bool {
+	if r.Change != ChangeUpdate {
+		return false
+	}
+
+	for _, a := range r.Attributes {
+		if !a.Upstream {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConfigDiff contains the changes between two configs
+type ConfigDiff struct {
+	Created []*ResourceChange
+	Deleted []*ResourceChange
+	Updated []*ResourceChange
+}
+
+// HasChanges returns true if any resources have been created, deleted or updated
+func (d *ConfigDiff) HasChanges() bool {
+	return len(d.Created) > 0 || len(d.Deleted) > 0 || len(d.Updated) > 0
+}
+
+// Diff compares two configs and returns the resources that have been created,
+// deleted and updated. Resources are matched using their FQDN, updated resources
+// contain the before and after values of every changed attribute.
+//
+// Either config can be nil, i.e. to diff against an empty config.
+func Diff(old, new *Config) (*ConfigDiff, error) {
+	if old == nil {
+		old = NewConfig()
+	}
+
+	if new == nil {
+		new = NewConfig()
+	}
+
+	diff := &ConfigDiff{
+		Created: []*ResourceChange{},
+		Deleted: []*ResourceChange{},
+		Updated: []*ResourceChange{},
+	}
+
+	oldResources := map[string]types.Resource{}
+	for _, r := range old.Resources {
+		oldResources[resourceFQDN(r)] = r
+	}
+
+	for _, r := range new.Resources {
+		fqdn := resourceFQDN(r)
+
+		or, ok := oldResources[fqdn]
+		if !ok {
+			diff.Created = append(diff.Created, &ResourceChange{FQDN: fqdn, Change: ChangeCreate, After: r})
+			continue
+		}
+
+		delete(oldResources, fqdn)
+
+		attrs, err := diffResource(old, or, new, r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compare resource %s: %s", fqdn, err)
+		}
+
+		if len(attrs) > 0 {
+			diff.Updated = append(diff.Updated, &ResourceChange{FQDN: fqdn, Change: ChangeUpdate, Before: or, After: r, Attributes: attrs})
+		}
+	}
+
+	// anything left has been deleted, preserve the order of the old config
+	for _, r := range old.Resources {
+		if _, ok := oldResources[resourceFQDN(r)]; ok {
+			diff.Deleted = append(diff.Deleted, &ResourceChange{FQDN: resourceFQDN(r), Change: ChangeDelete, Before: r})
+		}
+	}
+
+	return diff, nil
+}
+
+// resourceFQDN returns the fully qualified name for a resource
+func resourceFQDN(r types.Resource) string {
+	return ResourceFQDN{Module: r.Metadata().Module, Type: r.Metadata().Type, Resource: r.Metadata().Name}.String()
+}
+
+func diffResource(oldConfig *Config, old types.Resource, newConfig *Config, new types.Resource) ([]AttributeChange, error) {
+	before, err := oldConfig.attributeValues(old)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := newConfig.attributeValues(new)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for k := range before {
+		names[k] = true
+	}
+
+	for k := range after {
+		names[k] = true
+	}
+
+	changes := []AttributeChange{}
+
+	for name := range names {
+		if reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+
+		changes = append(changes, AttributeChange{
+			Name:     name,
+			Before:   before[name],
+			After:    after[name],
+			Upstream: isUpstreamChange(oldConfig, old, newConfig, new, name),
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+
+	return changes, nil
+}
+
+// attributeValues returns the values of a resource keyed by attribute name,
+// values are normalized through JSON so that evaluated interface{} attributes
+// can be compared with their decoded counterparts
+func (c *Config) attributeValues(r types.Resource) (map[string]interface{}, error) {
+	d, err := c.marshalResource(r, false)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]json.RawMessage{}
+	err = json.Unmarshal(d, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+
+	v := reflect.ValueOf(r).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+
+		name, kind, ok := types.ParseHCLTag(f)
+		if kind == "remain" {
+			continue
+		}
+
+		jsonName := jsonFieldName(f)
+		if jsonName == "" || !f.IsExported() {
+			continue
+		}
+
+		if !ok || name == "" {
+			name = jsonName
+		}
+
+		var val interface{}
+		if rv, ok := raw[jsonName]; ok {
+			err := json.Unmarshal(rv, &val)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		values[name] = val
+	}
+
+	// meta-arguments, resources can redefine these so only add when missing
+	if _, ok := values["disabled"]; !ok {
+		values["disabled"] = r.Metadata().Disabled
+	}
+
+	if _, ok := values["depends_on"]; !ok {
+		values["depends_on"] = c.dependsOnValue(r)
+	}
+
+	if _, ok := values["lifecycle"]; !ok {
+		var lc interface{}
+		if rv, ok := raw["lifecycle"]; ok {
+			err := json.Unmarshal(rv, &lc)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		values["lifecycle"] = lc
+	}
+
+	return values, nil
+}
+
+// dependsOnValue returns the depends_on attribute as it was written in the config,
+// the parser appends links to other resources and the dependencies of config
+// functions to DependsOn so only the original attribute is compared
+func (c *Config) dependsOnValue(r types.Resource) interface{} {
+	body, err := c.getBody(r)
+	if err != nil || body == nil {
+		// configs decoded from JSON do not have a body, remove the links
+		return dependsOnWithoutLinks(r)
+	}
+
+	a, ok := body.Attributes["depends_on"]
+	if !ok {
+		return nil
+	}
+
+	val, diags := a.Expr.Value(nil)
+	if diags.HasErrors() || !val.CanIterateElements() {
+		return string(c.source(a.Expr.Range()))
+	}
+
+	deps := []interface{}{}
+	for it := val.ElementIterator(); it.Next(); {
+		_, v := it.Element()
+		if v.Type() != cty.String {
+			return string(c.source(a.Expr.Range()))
+		}
+
+		deps = append(deps, v.AsString())
+	}
+
+	if len(deps) == 0 {
+		return nil
+	}
+
+	return deps
+}
+
+// dependsOnWithoutLinks returns the dependencies of a resource without the
+// links to other resources
+func dependsOnWithoutLinks(r types.Resource) interface{} {
+	links := map[string]bool{}
+	for _, l := range r.Metadata().ResourceLinks {
+		links[l] = true
+	}
+
+	deps := []interface{}{}
+	for _, d := range r.Metadata().DependsOn {
+		if !links[d] {
+			deps = append(deps, d)
+		}
+	}
+
+	if len(deps) == 0 {
+		return nil
+	}
+
+	return deps
+}
+
+// jsonFieldName returns the name used by encoding/json for a field
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		return f.Name
+	}
+
+	return name
+}
+
+// isUpstreamChange returns true when the source of the attribute or blocks with
+// the given name is unchanged and references other resources
+func isUpstreamChange(oldConfig *Config, old types.Resource, newConfig *Config, new types.Resource, name string) bool {
+	oldBody, _ := oldConfig.getBody(old)
+	newBody, _ := newConfig.getBody(new)
+
+	if oldBody == nil || newBody == nil {
+		return false
+	}
+
+	oldSrc, _ := oldConfig.attributeSource(oldBody, name)
+	newSrc, refs := newConfig.attributeSource(newBody, name)
+
+	return newSrc != nil && refs && bytes.Equal(oldSrc, newSrc)
+}
+
+// attributeSource returns the original source for the attribute or blocks
+// with the given name and whether the source references resources or variables
+func (c *Config) attributeSource(body *hclsyntax.Body, name string) ([]byte, bool) {
+	if a, ok := body.Attributes[name]; ok {
+		return c.source(a.Expr.Range()), len(a.Expr.Variables()) > 0
+	}
+
+	src := []byte{}
+	hasRefs := false
+
+	for _, b := range body.Blocks {
+		if b.Type != name {
+			continue
+		}
+
+		s := c.source(b.Range())
+		if s == nil {
+			return nil, false
+		}
+
+		src = append(src, s...)
+
+		hclsyntax.VisitAll(b.Body, func(n hclsyntax.Node) hcl.Diagnostics {
+			if a, ok := n.(*hclsyntax.Attribute); ok {
+				hasRefs = hasRefs || len(a.Expr.Variables()) > 0
+			}
+
+			return nil
+		})
+	}
+
+	if len(src) == 0 {
+		return nil, false
+	}
+
+	return src, hasRefs
+}
+
+// source returns the source bytes for the given range, the contents of the
+// files are stored when the config is parsed so that the source can be read
+// even if the file has since changed
+func (c *Config) source(r hcl.Range) []byte {
+	src, ok := c.sources[r.Filename]
+	if !ok || r.End.Byte > len(src) {
+		return nil
+	}
+
+	return src[r.Start.Byte:r.End.Byte]
+}
+
+// addSource stores the contents of a parsed file
+func (c *Config) addSource(file string, src []byte) {
+	if c.sources == nil {
+		c.sources = map[string][]byte{}
+	}
+
+	c.sources[file] = src
+}
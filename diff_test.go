@@ -0,0 +1,241 @@
+package hclconfig
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var diffOld = `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "consul" {
+  command = ["consul", "agent"]
+
+  volume {
+    source      = resource.network.onprem.subnet
+    destination = "/data"
+  }
+}
+
+container "vault" {
+  command = ["vault"]
+}
+`
+
+var diffNew = `
+network "onprem" {
+  subnet = "10.7.0.0/16"
+}
+
+container "consul" {
+  command = ["consul", "agent", "-dev"]
+
+  volume {
+    source      = resource.network.onprem.subnet
+    destination = "/data"
+  }
+}
+
+container "nomad" {
+  command = ["nomad"]
+}
+`
+
+func parseDiffConfig(t *testing.T, contents string) *Config {
+	c, p := setupParser(t)
+
+	err := p.ParseFile(CreateTestFile(t, contents), c)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestDiffReturnsCreatedAndDeletedResources(t *testing.T) {
+	d, err := Diff(parseDiffConfig(t, diffOld), parseDiffConfig(t, diffNew))
+	require.NoError(t, err)
+	require.True(t, d.HasChanges())
+
+	require.Len(t, d.Created, 1)
+	require.Equal(t, "resource.container.nomad", d.Created[0].FQDN)
+	require.Nil(t, d.Created[0].Before)
+
+	require.Len(t, d.Deleted, 1)
+	require.Equal(t, "resource.container.vault", d.Deleted[0].FQDN)
+	require.Nil(t, d.Deleted[0].After)
+}
+
+func TestDiffReturnsChangedAttributes(t *testing.T) {
+	d, err := Diff(parseDiffConfig(t, diffOld), parseDiffConfig(t, diffNew))
+	require.NoError(t, err)
+
+	require.Len(t, d.Updated, 2)
+
+	net := d.Updated[0]
+	require.Equal(t, "resource.network.onprem", net.FQDN)
+	require.Len(t, net.Attributes, 1)
+	require.Equal(t, "subnet", net.Attributes[0].Name)
+	require.Equal(t, "10.6.0.0/16", net.Attributes[0].Before)
+	require.Equal(t, "10.7.0.0/16", net.Attributes[0].After)
+	require.False(t, net.Attributes[0].Upstream)
+
+	con := d.Updated[1]
+	require.Equal(t, "resource.container.consul", con.FQDN)
+	require.Len(t, con.Attributes, 2)
+	require.False(t, con.Upstream())
+
+	require.Equal(t, "command", con.Attributes[0].Name)
+	require.Equal(t, []interface{}{"consul", "agent", "-dev"}, con.Attributes[0].After)
+	require.False(t, con.Attributes[0].Upstream)
+
+	// the volume has not been edited, the value changed because the network changed
+	require.Equal(t, "volume", con.Attributes[1].Name)
+	require.Equal(t, "10.6.0.0/16", con.Attributes[1].Before.([]interface{})[0].(map[string]interface{})["source"])
+	require.Equal(t, "10.7.0.0/16", con.Attributes[1].After.([]interface{})[0].(map[string]interface{})["source"])
+	require.True(t, con.Attributes[1].Upstream)
+}
+
+func TestDiffWithSameConfigReturnsNoChanges(t *testing.T) {
+	d, err := Diff(parseDiffConfig(t, diffOld), parseDiffConfig(t, diffOld))
+	require.NoError(t, err)
+	require.False(t, d.HasChanges())
+}
+
+func TestDiffWithNilConfigReturnsCreated(t *testing.T) {
+	d, err := Diff(nil, parseDiffConfig(t, diffOld))
+	require.NoError(t, err)
+	require.Len(t, d.Created, 3)
+}
+
+// copyModulesFixture copies the modules fixture to a temporary directory and applies
+// the replacements to the file with the given name
+func copyModulesFixture(t *testing.T, file, old, new string) string {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	for _, f := range []string{"modules/modules.hcl", "single/container.hcl"} {
+		d, err := ioutil.ReadFile(filepath.Join("test_fixtures", f))
+		require.NoError(t, err)
+
+		contents := string(d)
+		if f == file {
+			contents = strings.Replace(contents, old, new, 1)
+		}
+
+		writeTestFile(t, dir, f, contents)
+	}
+
+	return filepath.Join(dir, "modules", "modules.hcl")
+}
+
+func parseDiffFile(t *testing.T, file string) *Config {
+	c, p := setupParser(t)
+
+	err := p.ParseFile(file, c)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestDiffReturnsUpstreamChangesForResourcesInModules(t *testing.T) {
+	old := parseDiffFile(t, copyModulesFixture(t, "", "", ""))
+	new := parseDiffFile(t, copyModulesFixture(t, "modules/modules.hcl", "cpu = 4096", "cpu = 2048"))
+
+	d, err := Diff(old, new)
+	require.NoError(t, err)
+
+	fqdns := []string{}
+	for _, u := range d.Updated {
+		fqdns = append(fqdns, u.FQDN)
+	}
+
+	require.Contains(t, fqdns, "resource.container.base")
+	require.Contains(t, fqdns, "module.consul_1.resource.container.consul")
+
+	for _, u := range d.Updated {
+		switch u.FQDN {
+		case "resource.container.base":
+			require.False(t, u.Upstream())
+		case "module.consul_1.resource.container.consul":
+			// the cpu is set by the module variable, the module has not been edited
+			require.True(t, u.Upstream())
+		}
+	}
+}
+
+func TestDiffReturnsDirectEditsForResourcesInModules(t *testing.T) {
+	old := parseDiffFile(t, copyModulesFixture(t, "", "", ""))
+	new := parseDiffFile(t, copyModulesFixture(t, "single/container.hcl", `"-dev", `, ""))
+
+	d, err := Diff(old, new)
+	require.NoError(t, err)
+
+	require.Len(t, d.Updated, 2)
+
+	for _, u := range d.Updated {
+		require.Len(t, u.Attributes, 1)
+		require.Equal(t, "command", u.Attributes[0].Name)
+		require.False(t, u.Attributes[0].Upstream)
+	}
+}
+
+func TestDiffIgnoresDependenciesAddedByTheParser(t *testing.T) {
+	old := parseDiffConfig(t, `
+network "a" {
+  subnet = "10.6.0.0/16"
+}
+
+network "b" {
+  subnet = "10.7.0.0/16"
+}
+`)
+
+	new := parseDiffConfig(t, `
+network "a" {
+  subnet = "10.6.0.0/16"
+}
+
+network "b" {
+  subnet = resource_exists("resource.network.a") ? "10.8.0.0/16" : "10.7.0.0/16"
+}
+`)
+
+	d, err := Diff(old, new)
+	require.NoError(t, err)
+
+	require.Len(t, d.Updated, 1)
+	require.Len(t, d.Updated[0].Attributes, 1)
+	require.Equal(t, "subnet", d.Updated[0].Attributes[0].Name)
+}
+
+func TestDiffReturnsChangedLifecycle(t *testing.T) {
+	old := parseDiffConfig(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+`)
+
+	new := parseDiffConfig(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    retries = 3
+  }
+}
+`)
+
+	d, err := Diff(old, new)
+	require.NoError(t, err)
+
+	require.Len(t, d.Updated, 1)
+	require.Len(t, d.Updated[0].Attributes, 1)
+	require.Equal(t, "lifecycle", d.Updated[0].Attributes[0].Name)
+	require.Nil(t, d.Updated[0].Attributes[0].Before)
+	require.Equal(t, map[string]interface{}{"retries": float64(3)}, d.Updated[0].Attributes[0].After)
+}
@@ -0,0 +1,288 @@
+/*
+Package docs generates reference documentation for resources registered
+with the parser. Pages are generated from the hcl struct tags of the
+registered types and the optional `description` and `default` tags.
+
+	p := hclconfig.NewParser(hclconfig.DefaultOptions())
+	p.RegisterType("container", &Container{})
+
+	pages, err := docs.Generate(p.RegisteredTypes(), docs.Markdown)
+*/
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// Format defines the output format of the generated pages
+type Format string
+
+const (
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+)
+
+// Page is the generated reference documentation for a single resource type
+type Page struct {
+	// Type is the name of the registered type
+	Type string
+
+	// Filename is the suggested filename for the page i.e. container.md
+	Filename string
+
+	Content []byte
+}
+
+// section is a nested block rendered as its own section of the page
+type section struct {
+	Path  string
+	Block *types.BlockSchema
+}
+
+type pageData struct {
+	Type         string
+	Resource     *types.BlockSchema
+	Sections     []section
+	Meta         []*types.AttributeSchema
+	MetaSections []section
+}
+
+// Generate creates a reference page for every registered type, the built in
+// types variable, output and module are not documented.
+// Pages are returned ordered by type name
+func Generate(rt types.RegisteredTypes, f Format) ([]Page, error) {
+	defaults := types.DefaultTypes()
+	pages := []Page{}
+
+	for _, s := range rt.Schemas() {
+		if _, ok := defaults[s.Name]; ok {
+			continue
+		}
+
+		p, err := GeneratePage(s, f)
+		if err != nil {
+			return nil, err
+		}
+
+		pages = append(pages, *p)
+	}
+
+	return pages, nil
+}
+
+// GeneratePage creates a reference page for the given schema
+func GeneratePage(s *types.BlockSchema, f Format) (*Page, error) {
+	data := newPageData(s)
+	buf := bytes.NewBuffer(nil)
+
+	var ext string
+	var err error
+
+	switch f {
+	case Markdown:
+		ext = "md"
+		err = markdownTemplate.Execute(buf, data)
+	case HTML:
+		ext = "html"
+		err = htmlTemplate.Execute(buf, data)
+	default:
+		return nil, fmt.Errorf("unknown documentation format: %s", f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate documentation for %s: %s", s.Name, err)
+	}
+
+	return &Page{
+		Type:     s.Name,
+		Filename: fmt.Sprintf("%s.%s", s.Name, ext),
+		Content:  buf.Bytes(),
+	}, nil
+}
+
+// Write writes the pages to the given directory, creating the directory
+// if it does not exist
+func Write(dir string, pages []Page) error {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("unable to create directory %s: %s", dir, err)
+	}
+
+	for _, p := range pages {
+		err := os.WriteFile(filepath.Join(dir, p.Filename), p.Content, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to write documentation for %s: %s", p.Type, err)
+		}
+	}
+
+	return nil
+}
+
+func newPageData(s *types.BlockSchema) pageData {
+	data := pageData{
+		Type: s.Name,
+		Resource: &types.BlockSchema{
+			Name:        s.Name,
+			Description: s.Description,
+		},
+	}
+
+	metaBlocks := []*types.BlockSchema{}
+
+	// separate the meta-arguments from the attributes defined by the type
+	for _, a := range s.Attributes {
+		if a.Meta {
+			data.Meta = append(data.Meta, a)
+			continue
+		}
+
+		data.Resource.Attributes = append(data.Resource.Attributes, a)
+	}
+
+	// meta blocks i.e. lifecycle are documented with the meta-arguments
+	for _, b := range s.Blocks {
+		if b.Meta {
+			metaBlocks = append(metaBlocks, b)
+			continue
+		}
+
+		data.Resource.Blocks = append(data.Resource.Blocks, b)
+	}
+
+	data.Sections = flattenBlocks("", data.Resource.Blocks)
+	data.MetaSections = flattenBlocks("", metaBlocks)
+
+	return data
+}
+
+// flattenBlocks returns all nested blocks, depth first, with the path
+// from the resource i.e. build, volume, resources.limits
+func flattenBlocks(parent string, blocks []*types.BlockSchema) []section {
+	sections := []section{}
+
+	for _, b := range blocks {
+		p := b.Name
+		if parent != "" {
+			p = parent + "." + b.Name
+		}
+
+		sections = append(sections, section{Path: p, Block: b})
+		sections = append(sections, flattenBlocks(p, b.Blocks)...)
+	}
+
+	return sections
+}
+
+var funcs = template.FuncMap{
+	"yesno": func(b bool) string {
+		if b {
+			return "yes"
+		}
+
+		return "no"
+	},
+	// cell escapes a value for a markdown table cell, pipes end the
+	// cell and newlines end the row
+	"cell": func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		s = strings.ReplaceAll(s, "\r\n", "<br>")
+
+		return strings.ReplaceAll(s, "\n", "<br>")
+	},
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(funcs).Parse(`# {{ .Type }}
+{{ with .Resource.Description }}
+{{ . }}
+{{ end }}
+## Attributes
+{{ template "attributes" .Resource.Attributes }}
+{{- if .Sections }}
+## Blocks
+{{ template "sections" .Sections }}
+{{- end }}
+## Meta-Arguments
+{{ template "attributes" .Meta }}
+{{- if .MetaSections }}
+{{ template "sections" .MetaSections }}
+{{- end }}
+{{- define "sections" }}
+{{- range . }}
+### {{ .Path }}
+{{ with .Block.Description }}
+{{ . }}
+{{ end }}
+Required: {{ yesno .Block.Required }}, Repeated: {{ yesno .Block.Repeated }}
+{{- if .Block.Attributes }}
+{{ template "attributes" .Block.Attributes }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- define "attributes" }}
+{{- if . }}
+| Name | Type | Required | Default | Description |
+| ---- | ---- | -------- | ------- | ----------- |
+{{- range . }}
+| {{ cell .Name }} | {{ cell .Type }} | {{ yesno .Required }} | {{ cell .Default }} | {{ cell .Description }} |
+{{- end }}
+{{- else }}
+No attributes
+{{- end }}
+{{ end -}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Type }}</title>
+</head>
+<body>
+<h1>{{ .Type }}</h1>
+{{- with .Resource.Description }}
+<p>{{ . }}</p>
+{{- end }}
+<h2>Attributes</h2>
+{{ template "attributes" .Resource.Attributes }}
+{{- if .Sections }}
+<h2>Blocks</h2>
+{{- template "sections" .Sections }}
+{{- end }}
+<h2>Meta-Arguments</h2>
+{{ template "attributes" .Meta }}
+{{- template "sections" .MetaSections }}
+</body>
+</html>
+{{- define "sections" }}
+{{- range . }}
+<h3>{{ .Path }}</h3>
+{{- with .Block.Description }}
+<p>{{ . }}</p>
+{{- end }}
+<p>Required: {{ yesno .Block.Required }}, Repeated: {{ yesno .Block.Repeated }}</p>
+{{- if .Block.Attributes }}
+{{ template "attributes" .Block.Attributes }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- define "attributes" }}
+{{- if . }}
+<table>
+<tr><th>Name</th><th>Type</th><th>Required</th><th>Default</th><th>Description</th></tr>
+{{- range . }}
+<tr><td>{{ .Name }}</td><td>{{ .Type }}</td><td>{{ yesno .Required }}</td><td>{{ .Default }}</td><td>{{ .Description }}</td></tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No attributes</p>
+{{- end }}
+{{- end }}
+`))
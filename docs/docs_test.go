@@ -0,0 +1,110 @@
+package docs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTypes() types.RegisteredTypes {
+	rt := types.DefaultTypes()
+	rt["container"] = &structs.Container{}
+	rt["network"] = &structs.Network{}
+
+	return rt
+}
+
+func TestGenerateCreatesPagePerRegisteredType(t *testing.T) {
+	pages, err := Generate(setupTypes(), Markdown)
+	require.NoError(t, err)
+
+	require.Len(t, pages, 2)
+	require.Equal(t, "container", pages[0].Type)
+	require.Equal(t, "container.md", pages[0].Filename)
+	require.Equal(t, "network", pages[1].Type)
+}
+
+func TestGenerateMarkdownListsAttributesAndBlocks(t *testing.T) {
+	pages, err := Generate(setupTypes(), Markdown)
+	require.NoError(t, err)
+
+	md := string(pages[0].Content)
+
+	require.Contains(t, md, "# container")
+	require.Contains(t, md, "| command | list(string) | no |  |  |")
+	require.Contains(t, md, "### network")
+	require.Contains(t, md, "| ip_address | string | no |  |  |")
+	require.Contains(t, md, "### volume")
+	require.Contains(t, md, "### resources")
+	require.Contains(t, md, "## Meta-Arguments")
+	require.Contains(t, md, "| depends_on | list(string) | no |  |  |")
+	require.Contains(t, md, "| disabled | bool | no |  |  |")
+}
+
+func TestGenerateMarkdownListsLifecycleWithMetaArguments(t *testing.T) {
+	pages, err := Generate(setupTypes(), Markdown)
+	require.NoError(t, err)
+
+	md := string(pages[0].Content)
+
+	meta := strings.Index(md, "## Meta-Arguments")
+	lifecycle := strings.Index(md, "### lifecycle")
+	require.Greater(t, meta, -1)
+	require.Greater(t, lifecycle, meta)
+	require.Contains(t, md, "| retries | number | no |  |  |")
+}
+
+type testEscaped struct {
+	types.ResourceMetadata `hcl:",remain"`
+
+	Mode string `hcl:"mode,optional" description:"either tcp | udp\nthe default is tcp" default:"tcp|udp"`
+}
+
+func TestGenerateMarkdownEscapesTableCells(t *testing.T) {
+	rt := types.DefaultTypes()
+	rt["escaped"] = &testEscaped{}
+
+	pages, err := Generate(rt, Markdown)
+	require.NoError(t, err)
+
+	md := string(pages[0].Content)
+
+	require.Contains(t, md, `| mode | string | no | tcp\|udp | either tcp \| udp<br>the default is tcp |`)
+}
+
+func TestGenerateHTMLListsAttributes(t *testing.T) {
+	pages, err := Generate(setupTypes(), HTML)
+	require.NoError(t, err)
+
+	html := string(pages[1].Content)
+
+	require.Equal(t, "network.html", pages[1].Filename)
+	require.Contains(t, html, "<h1>network</h1>")
+	require.Contains(t, html, "<td>subnet</td><td>string</td><td>yes</td>")
+}
+
+func TestGenerateWithUnknownFormatReturnsError(t *testing.T) {
+	_, err := Generate(setupTypes(), Format("pdf"))
+	require.Error(t, err)
+}
+
+func TestWriteCreatesFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs")
+
+	pages, err := Generate(setupTypes(), Markdown)
+	require.NoError(t, err)
+
+	err = Write(dir, pages)
+	require.NoError(t, err)
+
+	require.FileExists(t, filepath.Join(dir, "container.md"))
+
+	d, err := os.ReadFile(filepath.Join(dir, "network.md"))
+	require.NoError(t, err)
+	require.Equal(t, pages[1].Content, d)
+}
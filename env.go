@@ -0,0 +1,343 @@
+package hclconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// EnvironmentVariable is an environment variable that was read when parsing
+// or processing a config
+type EnvironmentVariable struct {
+	Name string `json:"name"`
+
+	// Set is false when the variable was not set in the environment
+	Set bool `json:"set"`
+
+	// Resources are the FQDNs of the resources that read the variable, variables
+	// read to set a variable i.e. in a variable default, a module input or using
+	// the VariableEnvPrefix are attributed to the resources that reference it
+	Resources []string `json:"resources,omitempty"`
+}
+
+// envRecorder records the environment variables read by a config
+type envRecorder struct {
+	m    sync.Mutex
+	vars map[string]*EnvironmentVariable
+
+	// resources are the resources currently being decoded for each context
+	resources map[*hcl.EvalContext]types.Resource
+
+	// captures collect the variables read with a context, see capture
+	captures map[*hcl.EvalContext]*[]string
+
+	// variableEnv are the environment variables read to set the value of each
+	// variable, keyed by the context the variable is defined in
+	variableEnv map[*hcl.EvalContext]map[string][]string
+}
+
+func newEnvRecorder() *envRecorder {
+	return &envRecorder{
+		vars:        map[string]*EnvironmentVariable{},
+		resources:   map[*hcl.EvalContext]types.Resource{},
+		captures:    map[*hcl.EvalContext]*[]string{},
+		variableEnv: map[*hcl.EvalContext]map[string][]string{},
+	}
+}
+
+// record adds the variable and the resource currently being decoded
+// with the given context
+func (e *envRecorder) record(ctx *hcl.EvalContext, name string, set bool) {
+	if e == nil {
+		return
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	v, ok := e.vars[name]
+	if !ok {
+		v = &EnvironmentVariable{Name: name, Set: set}
+		e.vars[name] = v
+	}
+
+	if c, ok := e.captures[ctx]; ok {
+		*c = append(*c, name)
+	}
+
+	r, ok := e.resources[ctx]
+	if !ok {
+		return
+	}
+
+	fqdn := resourceFQDN(r)
+	if !containsString(v.Resources, fqdn) {
+		v.Resources = append(v.Resources, fqdn)
+	}
+}
+
+// setResource sets the resource that is decoded with the given context, the
+// caller must hold the lock for the context and call the returned function
+// once the resource has been decoded
+func (e *envRecorder) setResource(ctx *hcl.EvalContext, r types.Resource) func() {
+	if e == nil {
+		return func() {}
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.resources[ctx] = r
+
+	return func() {
+		e.m.Lock()
+		defer e.m.Unlock()
+
+		delete(e.resources, ctx)
+	}
+}
+
+// capture calls fn and returns the names of the variables read with the given
+// context while it was called, the caller must hold the lock for the context
+func (e *envRecorder) capture(ctx *hcl.EvalContext, fn func()) []string {
+	if e == nil {
+		fn()
+		return nil
+	}
+
+	names := []string{}
+
+	e.m.Lock()
+	e.captures[ctx] = &names
+	e.m.Unlock()
+
+	fn()
+
+	e.m.Lock()
+	delete(e.captures, ctx)
+	e.m.Unlock()
+
+	return names
+}
+
+// setVariable records the environment variables read to set the variable,
+// replacing any recorded when the variable was previously set
+func (e *envRecorder) setVariable(ctx *hcl.EvalContext, variable string, names []string) {
+	if e == nil {
+		return
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if _, ok := e.variableEnv[ctx]; !ok {
+		e.variableEnv[ctx] = map[string][]string{}
+	}
+
+	e.variableEnv[ctx][variable] = names
+}
+
+// setVariableIfMissing records the environment variables read to set the
+// variable when the variable has not already been set
+func (e *envRecorder) setVariableIfMissing(ctx *hcl.EvalContext, variable string, names []string) {
+	if e == nil {
+		return
+	}
+
+	e.m.Lock()
+	_, ok := e.variableEnv[ctx][variable]
+	e.m.Unlock()
+
+	if !ok {
+		e.setVariable(ctx, variable, names)
+	}
+}
+
+// referenced returns the environment variables read to set the variables
+// referenced by the node
+func (e *envRecorder) referenced(ctx *hcl.EvalContext, node hclsyntax.Node) []string {
+	if e == nil || node == nil {
+		return nil
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	names := []string{}
+	hclsyntax.VisitAll(node, func(n hclsyntax.Node) hcl.Diagnostics {
+		st, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || len(st.Traversal) < 2 || st.Traversal.RootName() != "var" {
+			return nil
+		}
+
+		if a, ok := st.Traversal[1].(hcl.TraverseAttr); ok {
+			names = append(names, e.variableEnv[ctx][a.Name]...)
+		}
+
+		return nil
+	})
+
+	return names
+}
+
+// evaluate returns the value of the expression and the environment variables
+// read to set it, including those read to set the variables it references
+func (e *envRecorder) evaluate(ctx *hcl.EvalContext, expr hcl.Expression) (cty.Value, []string) {
+	var val cty.Value
+	names := e.capture(ctx, func() {
+		val, _ = expr.Value(ctx)
+	})
+
+	if node, ok := expr.(hclsyntax.Node); ok {
+		names = append(names, e.referenced(ctx, node)...)
+	}
+
+	return val, names
+}
+
+// evaluateInputs returns the value of a module's variables and the environment
+// variables read to set each input, when the inputs are not an object literal
+// every input is attributed all the variables read by the expression
+func (e *envRecorder) evaluateInputs(ctx *hcl.EvalContext, expr hcl.Expression) (cty.Value, map[string][]string) {
+	val, names := e.evaluate(ctx, expr)
+
+	inputs := map[string][]string{}
+	if !val.CanIterateElements() {
+		return val, inputs
+	}
+
+	for it := val.ElementIterator(); it.Next(); {
+		k, _ := it.Element()
+		inputs[k.AsString()] = names
+	}
+
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return val, inputs
+	}
+
+	for _, item := range obj.Items {
+		k, diags := item.KeyExpr.Value(ctx)
+		if diags.HasErrors() || k.Type() != cty.String || !k.IsKnown() {
+			continue
+		}
+
+		_, inputs[k.AsString()] = e.evaluate(ctx, item.ValueExpr)
+	}
+
+	return val, inputs
+}
+
+// recordReferences attributes the environment variables read to set the
+// variables referenced by the node to the resource being decoded with ctx
+func (e *envRecorder) recordReferences(ctx *hcl.EvalContext, node hclsyntax.Node) {
+	if e == nil {
+		return
+	}
+
+	names := e.referenced(ctx, node)
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	r, ok := e.resources[ctx]
+	if !ok {
+		return
+	}
+
+	fqdn := resourceFQDN(r)
+	for _, name := range names {
+		// variables that were not recorded were not allowed
+		v, ok := e.vars[name]
+		if ok && !containsString(v.Resources, fqdn) {
+			v.Resources = append(v.Resources, fqdn)
+		}
+	}
+}
+
+// variables returns the recorded variables sorted by name
+func (e *envRecorder) variables() []EnvironmentVariable {
+	if e == nil {
+		return nil
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	vars := []EnvironmentVariable{}
+	for _, v := range e.vars {
+		ev := *v
+		if v.Resources != nil {
+			ev.Resources = append([]string{}, v.Resources...)
+			sort.Strings(ev.Resources)
+		}
+
+		vars = append(vars, ev)
+	}
+
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+	return vars
+}
+
+// envFunction creates the env function for the given context, variables that
+// are not allowed by AllowedEnv return an error as do unset variables when
+// RequireEnv is set
+func (p *Parser) envFunction(ctx *hcl.EvalContext) function.Function {
+	rec := p.env
+
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:             "env",
+				Type:             cty.String,
+				AllowDynamicType: true,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			name := args[0].AsString()
+
+			if !p.envAllowed(name) {
+				return cty.NilVal, fmt.Errorf("environment variable %s is not allowed, set ParserOptions.AllowedEnv to read the variable", name)
+			}
+
+			v, set := os.LookupEnv(name)
+			rec.record(ctx, name, set)
+
+			if !set && p.options.RequireEnv {
+				return cty.NilVal, fmt.Errorf("environment variable %s is not set", name)
+			}
+
+			return cty.StringVal(v), nil
+		},
+	})
+}
+
+// envAllowed returns true when the environment variable can be read
+func (p *Parser) envAllowed(name string) bool {
+	return len(p.options.AllowedEnv) == 0 || matchPattern(p.options.AllowedEnv, name)
+}
+
+// recordVariableEnv records the environment variable that sets the value of
+// the declared variable, when it is set and allowed
+func (p *Parser) recordVariableEnv(ctx *hcl.EvalContext, variable string) {
+	name := p.options.VariableEnvPrefix + variable
+	if _, set := os.LookupEnv(name); set && p.envAllowed(name) {
+		p.env.record(ctx, name, true)
+	}
+}
+
+// EnvironmentVariables returns the environment variables read by the config
+// and the resources that read them, variables read using a function with a
+// value in PinnedFunctions are not returned
+func (c *Config) EnvironmentVariables() []EnvironmentVariable {
+	return c.env.variables()
+}
@@ -0,0 +1,181 @@
+package hclconfig
+
+import (
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const envConfig = `
+variable "version" {
+  default = env("TEST_ENV_VERSION")
+}
+
+variable "name" {
+  default = "consul"
+}
+
+container "consul" {
+  command = [env("TEST_ENV_ADDR"), env("TEST_ENV_MISSING"), var.version]
+}
+
+container "vault" {
+  command = [env("TEST_ENV_ADDR"), var.name]
+}
+`
+
+func TestParseRecordsEnvironmentVariables(t *testing.T) {
+	t.Setenv("TEST_ENV_ADDR", "localhost")
+	t.Setenv("TEST_ENV_VERSION", "1.0")
+	t.Setenv("HCL_VAR_name", "vault")
+	t.Setenv("HCL_VAR_undeclared", "vault")
+
+	c, p := setupParser(t)
+
+	err := p.ParseFile(CreateTestFile(t, envConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.vault")
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost", "vault"}, r.(*structs.Container).Command)
+
+	// only variables that set a declared variable are recorded, variables read to
+	// set a variable are attributed to the resources that reference it
+	require.Equal(t, []EnvironmentVariable{
+		{Name: "HCL_VAR_name", Set: true, Resources: []string{"resource.container.vault"}},
+		{Name: "TEST_ENV_ADDR", Set: true, Resources: []string{"resource.container.consul", "resource.container.vault"}},
+		{Name: "TEST_ENV_MISSING", Set: false, Resources: []string{"resource.container.consul"}},
+		{Name: "TEST_ENV_VERSION", Set: true, Resources: []string{"resource.container.consul"}},
+	}, filterEnvironmentVariables(c.EnvironmentVariables(), "HCL_VAR_name", "HCL_VAR_undeclared", "TEST_ENV_"))
+}
+
+func TestParseRecordsEnvironmentVariablesReadByModuleInputs(t *testing.T) {
+	t.Setenv("TEST_ENV_CPU", "512")
+	t.Setenv("TEST_ENV_MEMORY", "1024")
+
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "main.hcl", `
+variable "memory" {
+  default = env("TEST_ENV_MEMORY")
+}
+
+module "sub" {
+  source = "./sub"
+
+  variables = {
+    cpu    = env("TEST_ENV_CPU")
+    memory = var.memory
+  }
+}
+`)
+	writeTestFile(t, dir, "sub/main.hcl", `
+variable "cpu" {
+  default = ""
+}
+
+variable "memory" {
+  default = ""
+}
+
+container "cpu" {
+  command = [var.cpu]
+}
+
+container "memory" {
+  command = [var.memory]
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ParseDirectory(dir, c)
+	require.NoError(t, err)
+
+	require.Equal(t, []EnvironmentVariable{
+		{Name: "TEST_ENV_CPU", Set: true, Resources: []string{"module.sub.resource.container.cpu", "resource.module.sub"}},
+		{Name: "TEST_ENV_MEMORY", Set: true, Resources: []string{"module.sub.resource.container.memory", "resource.module.sub"}},
+	}, filterEnvironmentVariables(c.EnvironmentVariables(), "TEST_ENV_"))
+}
+
+func TestParseWithAllowedEnvIgnoresVariablesNotAllowed(t *testing.T) {
+	t.Setenv("TEST_ENV_ADDR", "localhost")
+	t.Setenv("HCL_VAR_name", "vault")
+
+	o := DefaultOptions()
+	o.AllowedEnv = []string{"TEST_ENV_*"}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, envConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.vault")
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost", "consul"}, r.(*structs.Container).Command)
+
+	require.Empty(t, filterEnvironmentVariables(c.EnvironmentVariables(), "HCL_VAR_"))
+}
+
+func TestParseWithAllowedEnvReturnsErrorForVariablesNotAllowed(t *testing.T) {
+	t.Setenv("TEST_ENV_ADDR", "localhost")
+	t.Setenv("HCL_VAR_name", "vault")
+
+	o := DefaultOptions()
+	o.AllowedEnv = []string{"TEST_ENV_ADDR", "TEST_ENV_V*"}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, envConfig), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "environment variable TEST_ENV_MISSING is not allowed")
+	require.NotContains(t, err.Error(), "TEST_ENV_VERSION")
+}
+
+func TestParseWithRequireEnvReturnsErrorForUnsetVariables(t *testing.T) {
+	t.Setenv("TEST_ENV_ADDR", "localhost")
+	t.Setenv("TEST_ENV_VERSION", "1.0")
+	t.Setenv("HCL_VAR_name", "vault")
+
+	o := DefaultOptions()
+	o.RequireEnv = true
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, envConfig), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "environment variable TEST_ENV_MISSING is not set")
+}
+
+func TestParseWithPinnedEnvDoesNotRecordEnvironmentVariables(t *testing.T) {
+	t.Setenv("HCL_VAR_name", "vault")
+
+	o := DefaultOptions()
+	o.PinnedFunctions = map[string]cty.Value{"env": cty.StringVal("pinned")}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, envConfig), c)
+	require.NoError(t, err)
+
+	require.Empty(t, filterEnvironmentVariables(c.EnvironmentVariables(), "TEST_ENV_"))
+}
+
+// filterEnvironmentVariables removes variables set by the environment the
+// tests are running in
+func filterEnvironmentVariables(vars []EnvironmentVariable, prefixes ...string) []EnvironmentVariable {
+	filtered := []EnvironmentVariable{}
+	for _, v := range vars {
+		for _, p := range prefixes {
+			if len(v.Name) >= len(p) && v.Name[:len(p)] == p {
+				filtered = append(filtered, v)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
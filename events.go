@@ -0,0 +1,71 @@
+package hclconfig
+
+import (
+	"time"
+
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// EventType defines the stage of processing that an Event reports
+type EventType string
+
+const (
+	// EventScheduled is sent when all the dependencies of a resource have been
+	// processed and the resource is ready to be processed
+	EventScheduled EventType = "scheduled"
+	// EventDecodeStarted is sent before the links to other resources are
+	// resolved and the resource is decoded
+	EventDecodeStarted EventType = "decode_started"
+	// EventDecodeFinished is sent when the resource has been decoded
+	EventDecodeFinished EventType = "decode_finished"
+	// EventProcessStarted is sent before the Process method of a resource is called
+	EventProcessStarted EventType = "process_started"
+	// EventProcessFinished is sent after the Process method of a resource returns
+	EventProcessFinished EventType = "process_finished"
+	// EventCallbackFinished is sent after the ProcessCallback returns
+	EventCallbackFinished EventType = "callback_finished"
+	// EventSkippedDisabled is sent when a resource is not processed as it is disabled
+	EventSkippedDisabled EventType = "skipped_disabled"
+	// EventRetry is sent when Process or the ProcessCallback fails and will
+	// be retried, see RetryPolicy
+	EventRetry EventType = "retry"
+	// EventFailed is sent when processing a resource returns an error
+	EventFailed EventType = "failed"
+)
+
+// Event reports the progress of processing a resource
+type Event struct {
+	Type     EventType
+	FQDN     string
+	Resource types.Resource
+
+	// Time the event occurred
+	Time time.Time
+
+	// Duration of the stage for finished events, for EventFailed this is the
+	// time since the resource was scheduled
+	Duration time.Duration
+
+	// Error returned by the stage, set for EventFailed and for finished events
+	// when the stage failed
+	Error error
+}
+
+// EventCallback is called for every event, resources are processed in parallel
+// so the callback can be called concurrently
+type EventCallback func(e Event)
+
+// emit sends an event to the event callback, when start is not zero the
+// duration is set to the time since start
+func (c *Config) emit(t EventType, r types.Resource, start time.Time, err error) {
+	if c.onEvent == nil {
+		return
+	}
+
+	e := Event{Type: t, FQDN: resourceFQDN(r), Resource: r, Time: time.Now(), Error: err}
+	if !start.IsZero() {
+		e.Duration = e.Time.Sub(start)
+	}
+
+	c.onEvent(e)
+}
@@ -17,14 +17,19 @@ func main() {
 	p.RegisterType("config", &Config{})
 	p.RegisterType("postgres", &PostgreSQL{})
 
-	// register a custom function
-	p.RegisterFunction("random_number", func() (int, error) {
+	// register a custom function, random_number returns a different value each time
+	// it is called so it is marked as impure
+	err := p.RegisterFunction("random_number", func() (int, error) {
 		return rand.Intn(100), nil
-	})
+	}, hclconfig.Impure())
+	if err != nil {
+		fmt.Printf("Unable to register function: %s\n", err)
+		os.Exit(1)
+	}
 
 	c := hclconfig.NewConfig()
 
-	err := p.ParseFile("./config.hcl", c)
+	err = p.ParseFile("./config.hcl", c)
 	if err != nil {
 		fmt.Printf("An error occurred processing the config: %s\n", err)
 		os.Exit(1)
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/hashicorp/hcl2/hcl"
 	"github.com/shipyard-run/hclconfig/types"
 )
 
@@ -30,7 +31,8 @@ type Config struct {
 	Timeouts *Timeouts `hcl:"timeouts,block"`
 }
 
-func (t *Config) Process() error {
+// SetDefaults is called after the resource has been decoded and before it is validated
+func (t *Config) SetDefaults() error {
 	// override default values
 	if t.Timeouts.TLSHandshake == 0 {
 		t.Timeouts.TLSHandshake = 5
@@ -55,6 +57,22 @@ type PostgreSQL struct {
 	ConnectionString string `hcl:"connection_string,optional"`
 }
 
+// Validate is called before Process, any error diagnostics stop the config from being processed
+func (t *PostgreSQL) Validate() types.AttributeDiagnostics {
+	if t.Port < 1 || t.Port > 65535 {
+		return types.AttributeDiagnostics{{
+			Attribute: "port",
+			Diagnostic: &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid port",
+				Detail:   fmt.Sprintf("port %d must be between 1 and 65535", t.Port),
+			},
+		}}
+	}
+
+	return nil
+}
+
 // Process is called using an order calculated from the dependency graph
 // this is where you can set any computed fields
 func (t *PostgreSQL) Process() error {
@@ -0,0 +1,98 @@
+package hclconfig
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+// NamespaceSeparator separates the namespace and the name of a namespaced
+// function, HCL does not support `::` or `.` in function names so a function
+// registered as `cidr` in the namespace `net` is called as `net__cidr()`
+const NamespaceSeparator = "__"
+
+// Namespace registers the function in the given namespace, this allows libraries
+// to register functions with the same name without colliding
+func Namespace(ns string) FunctionOption {
+	return func(o *functionOptions) {
+		o.namespace = ns
+	}
+}
+
+// functionName returns the name the function is called with and checks
+// that it does not collide with an existing function
+func (p *Parser) functionName(name string, o *functionOptions) (string, error) {
+	if o.namespace != "" {
+		if !hclsyntax.ValidIdentifier(o.namespace) || strings.Contains(o.namespace, NamespaceSeparator) {
+			return "", fmt.Errorf("unable to register function %s: namespace %s is not a valid identifier", name, o.namespace)
+		}
+
+		name = o.namespace + NamespaceSeparator + name
+	}
+
+	if !hclsyntax.ValidIdentifier(name) {
+		return "", fmt.Errorf("unable to register function %s: name is not a valid identifier", name)
+	}
+
+	_, custom := p.registeredFunctions[name]
+	_, config := p.configFunctions[name]
+	_, builtinConfig := defaultConfigFunctions[name]
+	_, builtin := getDefaultFunctions("")[name]
+
+	if custom || config || builtinConfig || builtin || name == "templatefile" {
+		return "", fmt.Errorf("unable to register function %s: a function with the same name has already been registered", name)
+	}
+
+	return name, nil
+}
+
+// restrictModuleFunctions removes the functions that are not allowed by the
+// ModuleFunctions option from the context of a module, the functions allowed
+// in a module are also restricted by the modules parents
+func (p *Parser) restrictModuleFunctions(ctx *hcl.EvalContext, module string) {
+	if module == "" || len(p.options.ModuleFunctions) == 0 {
+		return
+	}
+
+	for name := range ctx.Functions {
+		if !p.moduleFunctionAllowed(module, name) {
+			delete(ctx.Functions, name)
+		}
+	}
+}
+
+// moduleFunctionAllowed checks the allowed functions for the module and each
+// of its parents
+func (p *Parser) moduleFunctionAllowed(module, name string) bool {
+	parts := strings.Split(module, ".")
+
+	for i := range parts {
+		m := strings.Join(parts[:i+1], ".")
+
+		patterns, ok := p.options.ModuleFunctions[m]
+		if !ok {
+			continue
+		}
+
+		if !matchPattern(patterns, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPattern returns true when the name matches one of the patterns, patterns
+// are names or globs i.e. net__* matches all functions in the net namespace
+func matchPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
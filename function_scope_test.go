@@ -0,0 +1,186 @@
+package hclconfig
+
+import (
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcessesNamespacedFunctions(t *testing.T) {
+	c, p := setupParser(t)
+
+	err := p.RegisterFunction("random", func() (string, error) { return "net", nil }, Namespace("net"))
+	require.NoError(t, err)
+
+	err = p.RegisterFunction("random", func() (string, error) { return "crypto", nil }, Namespace("crypto"))
+	require.NoError(t, err)
+
+	err = p.ParseFile(CreateTestFile(t, `
+container "consul" {
+  command = [net__random(), crypto__random()]
+}
+`), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"net", "crypto"}, r.(*structs.Container).Command)
+}
+
+func TestRegisterFunctionWithExistingNameReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterFunction("random", func() (int, error) { return 1, nil })
+	require.NoError(t, err)
+
+	err = p.RegisterFunction("random", func() (int, error) { return 2, nil })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already been registered")
+
+	err = p.RegisterFunction("random", func() (int, error) { return 2, nil }, Namespace("net"))
+	require.NoError(t, err)
+
+	err = p.RegisterFunction("random", func() (int, error) { return 2, nil }, Namespace("net"))
+	require.Error(t, err)
+}
+
+func TestRegisterFunctionWithBuiltInNameReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterFunction("upper", func(s string) (string, error) { return s, nil })
+	require.Error(t, err)
+
+	err = p.RegisterFunction("resource_exists", func(s string) (string, error) { return s, nil })
+	require.Error(t, err)
+}
+
+func TestRegisterFunctionWithInvalidNamespaceReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterFunction("random", func() (int, error) { return 1, nil }, Namespace("my__net"))
+	require.Error(t, err)
+
+	err = p.RegisterFunction("random", func() (int, error) { return 1, nil }, Namespace("my net"))
+	require.Error(t, err)
+}
+
+func parseModuleFunctions(t *testing.T, allowed map[string][]string) error {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "main.hcl", `
+container "root" {
+  command = [crypto__random()]
+}
+
+module "consul" {
+  source = "./consul"
+}
+`)
+
+	writeTestFile(t, dir, "consul/main.hcl", `
+container "consul" {
+  command = [net__random(), upper("consul")]
+}
+
+module "vault" {
+  source = "./vault"
+}
+`)
+
+	writeTestFile(t, dir, "consul/vault/main.hcl", `
+container "vault" {
+  command = [net__random()]
+}
+`)
+
+	o := DefaultOptions()
+	o.ModuleFunctions = allowed
+
+	c, p := setupParser(t, o)
+
+	err := p.RegisterFunction("random", func() (string, error) { return "net", nil }, Namespace("net"))
+	require.NoError(t, err)
+
+	err = p.RegisterFunction("random", func() (string, error) { return "crypto", nil }, Namespace("crypto"))
+	require.NoError(t, err)
+
+	return p.ParseDirectory(dir, c)
+}
+
+func TestParseWithModuleFunctionsAllowsFunctions(t *testing.T) {
+	err := parseModuleFunctions(t, map[string][]string{
+		"consul": {"net__*", "upper"},
+	})
+	require.NoError(t, err)
+}
+
+func TestParseWithModuleFunctionsReturnsErrorForFunctionsNotAllowed(t *testing.T) {
+	err := parseModuleFunctions(t, map[string][]string{
+		"consul": {"net__*"},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "consul/main.hcl")
+	require.Contains(t, err.Error(), `There is no function named "upper"`)
+}
+
+func TestParseWithModuleFunctionsRestrictsNestedModules(t *testing.T) {
+	err := parseModuleFunctions(t, map[string][]string{
+		"consul":       {"net__*", "upper"},
+		"consul.vault": {"upper"},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "consul/vault/main.hcl")
+	require.Contains(t, err.Error(), `There is no function named "net__random"`)
+}
+
+func TestParseWithModuleFunctionsRestrictsVariablesAndTemplates(t *testing.T) {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "main.hcl", `
+module "consul" {
+  source = "./consul"
+}
+`)
+
+	writeTestFile(t, dir, "consul/main.hcl", `
+container "consul" {
+  command = [templatefile("./consul.tpl", {})]
+}
+`)
+
+	writeTestFile(t, dir, "consul/consul.tpl", `${upper("consul")}`)
+
+	o := DefaultOptions()
+	o.ModuleFunctions = map[string][]string{"consul": {"templatefile"}}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseDirectory(dir, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `There is no function named "upper"`)
+
+	// errors in variable defaults are not returned, the variable is unknown
+	writeTestFile(t, dir, "consul/main.hcl", `
+variable "name" {
+  default = upper("consul")
+}
+
+container "consul" {
+  command = [var.name]
+}
+`)
+
+	c, p = setupParser(t, o)
+
+	err = p.ParseDirectory(dir, c)
+	require.Error(t, err)
+
+	o.ModuleFunctions = map[string][]string{"consul": {"upper"}}
+	c, p = setupParser(t, o)
+
+	err = p.ParseDirectory(dir, c)
+	require.NoError(t, err)
+}
@@ -1,195 +1,334 @@
 package hclconfig
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"github.com/zclconf/go-cty/cty/gocty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
 )
 
-func createCtyFunctionFromGoFunc(f interface{}) (function.Function, error) {
-	// get the parameters
-	inParams := []function.Parameter{}
-	var outParam function.TypeFunc
-
-	var outType reflect.Kind
-	inType := []reflect.Kind{}
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
+func createCtyFunctionFromGoFunc(f interface{}) (function.Function, error) {
 	rf := reflect.TypeOf(f)
+	if rf == nil || rf.Kind() != reflect.Func {
+		return function.Function{}, fmt.Errorf("HCL functions must be a Go function, got %v", rf)
+	}
 
-	if rf.NumOut() != 2 {
+	if rf.NumOut() != 2 || rf.Out(1) != errorType {
 		return function.Function{}, fmt.Errorf("HCL functions must return two parameters, the result and an error i.e func(a,b int) (int, error)")
 	}
 
+	// get the parameters, the last parameter of a variadic function is a slice
+	// that is mapped to the functions VarParam
+	inParams := []function.Parameter{}
+	var varParam *function.Parameter
+
 	for i := 0; i < rf.NumIn(); i++ {
 		fp := rf.In(i)
+		if rf.IsVariadic() && i == rf.NumIn()-1 {
+			fp = fp.Elem()
+		}
 
-		switch fp.Kind() {
-		case reflect.String:
-			appendParms(&inType, &inParams, fp.Name(), reflect.String, cty.String)
-		case reflect.Int16:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Int16, cty.Number)
-		case reflect.Int32:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Int32, cty.Number)
-		case reflect.Int64:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Int64, cty.Number)
-		case reflect.Int:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Int, cty.Number)
-		case reflect.Uint:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Uint, cty.Number)
-		case reflect.Uint16:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Uint16, cty.Number)
-		case reflect.Uint32:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Uint32, cty.Number)
-		case reflect.Uint64:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Uint64, cty.Number)
-		case reflect.Float32:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Float32, cty.Number)
-		case reflect.Float64:
-			appendParms(&inType, &inParams, fp.Name(), reflect.Float64, cty.Number)
-		default:
-			return function.Function{}, fmt.Errorf("type %v is not a valid cyt type, only primative types like string and basic numbers are supported", fp.Kind())
+		typ, err := goTypeToCty(fp)
+		if err != nil {
+			return function.Function{}, fmt.Errorf("parameter %d: %s", i, err)
 		}
+
+		param := function.Parameter{
+			Name:             fmt.Sprintf("arg%d", i),
+			Type:             typ,
+			AllowDynamicType: true,
+		}
+
+		if rf.IsVariadic() && i == rf.NumIn()-1 {
+			varParam = &param
+			continue
+		}
+
+		inParams = append(inParams, param)
 	}
 
-	outType = rf.Out(0).Kind()
-	switch outType {
-	case reflect.String:
-		outParam = function.StaticReturnType(cty.String)
-	case reflect.Int16:
-		fallthrough
-	case reflect.Int32:
-		fallthrough
-	case reflect.Int64:
-		fallthrough
-	case reflect.Uint16:
-		fallthrough
-	case reflect.Uint32:
-		fallthrough
-	case reflect.Uint64:
-		fallthrough
-	case reflect.Float32:
-		fallthrough
-	case reflect.Float64:
-		fallthrough
-	case reflect.Int:
-		fallthrough
-	case reflect.Uint:
-		outParam = function.StaticReturnType(cty.Number)
-	default:
-		return function.Function{}, fmt.Errorf("type %v is not a valid cyt type, only primative types like string and basic numbers are supported", rf.Out(0).Kind())
+	outType, err := goTypeToCty(rf.Out(0))
+	if err != nil {
+		return function.Function{}, fmt.Errorf("return value: %s", err)
 	}
 
 	return function.New(&function.Spec{
-		Params: inParams,
+		Params:   inParams,
+		VarParam: varParam,
+		Type:     function.StaticReturnType(outType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-
 			// create the params
 			in := []reflect.Value{}
 			for i, a := range args {
-				switch a.Type() {
-				case cty.String:
-					in = append(in, reflect.ValueOf(a.AsString()))
-				case cty.Number:
-					bf := a.AsBigFloat()
-					switch inType[i] {
-					case reflect.Int16:
-						val, _ := bf.Int64()
-						in = append(in, reflect.ValueOf(int16(val)))
-					case reflect.Int32:
-						val, _ := bf.Int64()
-						in = append(in, reflect.ValueOf(int32(val)))
-					case reflect.Int64:
-						val, _ := bf.Int64()
-						in = append(in, reflect.ValueOf(int64(val)))
-					case reflect.Int:
-						val, _ := bf.Int64()
-						in = append(in, reflect.ValueOf(int(val)))
-					case reflect.Uint16:
-						val, _ := bf.Uint64()
-						in = append(in, reflect.ValueOf(uint16(val)))
-					case reflect.Uint32:
-						val, _ := bf.Uint64()
-						in = append(in, reflect.ValueOf(uint32(val)))
-					case reflect.Uint64:
-						val, _ := bf.Uint64()
-						in = append(in, reflect.ValueOf(uint64(val)))
-					case reflect.Uint:
-						val, _ := bf.Uint64()
-						in = append(in, reflect.ValueOf(uint(val)))
-					case reflect.Float32:
-						val, _ := bf.Float64()
-						in = append(in, reflect.ValueOf(float32(val)))
-					case reflect.Float64:
-						val, _ := bf.Float64()
-						in = append(in, reflect.ValueOf(float64(val)))
-					}
+				var pt reflect.Type
+				if rf.IsVariadic() && i >= rf.NumIn()-1 {
+					pt = rf.In(rf.NumIn() - 1).Elem()
+				} else {
+					pt = rf.In(i)
 				}
+
+				v, err := ctyToGoValue(a, pt)
+				if err != nil {
+					return cty.NullVal(retType), function.NewArgErrorf(i, "unable to convert argument %d: %s", i, err)
+				}
+
+				in = append(in, v)
 			}
 
 			out := reflect.ValueOf(f).Call(in)
 
-			switch retType {
-			case cty.String:
-				if out[1].Interface() == nil {
-					return cty.StringVal(out[0].String()), nil
-				} else {
-					return cty.StringVal(out[0].String()), out[1].Interface().(error)
-				}
-			case cty.Number:
-				switch outType {
-				case reflect.Int16:
-					fallthrough
-				case reflect.Int32:
-					fallthrough
-				case reflect.Int64:
-					fallthrough
-				case reflect.Int:
-					if out[1].Interface() == nil {
-						return cty.NumberIntVal(out[0].Int()), nil
-					} else {
-						return cty.NumberIntVal(out[0].Int()), out[1].Interface().(error)
-					}
-				case reflect.Uint16:
-					fallthrough
-				case reflect.Uint32:
-					fallthrough
-				case reflect.Uint64:
-					fallthrough
-				case reflect.Uint:
-					if out[1].Interface() == nil {
-						return cty.NumberUIntVal(out[0].Uint()), nil
-					} else {
-						return cty.NumberUIntVal(out[0].Uint()), out[1].Interface().(error)
-					}
-				case reflect.Float32:
-					fallthrough
-				case reflect.Float64:
-					if out[1].Interface() == nil {
-						return cty.NumberFloatVal(out[0].Float()), nil
-					} else {
-						return cty.NumberFloatVal(out[0].Float()), out[1].Interface().(error)
-					}
-				}
+			if !out[1].IsNil() {
+				return cty.NullVal(retType), out[1].Interface().(error)
+			}
+
+			val, err := goValueToCty(out[0])
+			if err != nil {
+				return cty.NullVal(retType), err
 			}
 
-			return cty.NullVal(retType), nil
+			return convert.Convert(val, retType)
 		},
-		Type: outParam,
 	}), nil
 }
 
-func appendParms(inType *[]reflect.Kind, params *[]function.Parameter, name string, kind reflect.Kind, typ cty.Type) {
-	*inType = append(*inType, kind)
-	*params = append(*params, function.Parameter{
-		Name:             name,
-		Type:             typ,
-		AllowDynamicType: true,
-	})
+// goTypeToCty returns the cty type for a go type, structs are converted to
+// objects using the hcl or json tag of each field as the attribute name
+func goTypeToCty(t reflect.Type) (cty.Type, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return cty.String, nil
+	case reflect.Bool:
+		return cty.Bool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return cty.Number, nil
+	case reflect.Slice, reflect.Array:
+		et, err := goTypeToCty(t.Elem())
+		if err != nil {
+			return cty.NilType, err
+		}
+
+		return cty.List(et), nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return cty.NilType, fmt.Errorf("type %v is not a valid cty type, only maps with string keys are supported", t)
+		}
+
+		et, err := goTypeToCty(t.Elem())
+		if err != nil {
+			return cty.NilType, err
+		}
+
+		return cty.Map(et), nil
+	case reflect.Ptr:
+		if t.Elem().Kind() != reflect.Struct {
+			return cty.NilType, fmt.Errorf("type %v is not a valid cty type, only pointers to structs are supported", t)
+		}
+
+		return goTypeToCty(t.Elem())
+	case reflect.Struct:
+		attrs := map[string]cty.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			name := structFieldName(f)
+			if name == "" {
+				continue
+			}
+
+			at, err := goTypeToCty(f.Type)
+			if err != nil {
+				return cty.NilType, fmt.Errorf("field %s: %s", f.Name, err)
+			}
+
+			attrs[name] = at
+		}
+
+		return cty.Object(attrs), nil
+	}
+
+	return cty.NilType, fmt.Errorf("type %v is not a valid cty type, only strings, numbers, bools, slices, maps and structs are supported", t)
+}
+
+// ctyToGoValue converts a cty value into a go value of the given type
+func ctyToGoValue(v cty.Value, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	if v.IsNull() {
+		return out, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		out = reflect.MakeSlice(t, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+
+			e, err := ctyToGoValue(ev, t.Elem())
+			if err != nil {
+				return out, err
+			}
+
+			out = reflect.Append(out, e)
+		}
+	case reflect.Array:
+		i := 0
+		for it := v.ElementIterator(); it.Next() && i < t.Len(); i++ {
+			_, ev := it.Element()
+
+			e, err := ctyToGoValue(ev, t.Elem())
+			if err != nil {
+				return out, err
+			}
+
+			out.Index(i).Set(e)
+		}
+	case reflect.Map:
+		out = reflect.MakeMap(t)
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+
+			e, err := ctyToGoValue(ev, t.Elem())
+			if err != nil {
+				return out, err
+			}
+
+			out.SetMapIndex(reflect.ValueOf(k.AsString()).Convert(t.Key()), e)
+		}
+	case reflect.Ptr:
+		e, err := ctyToGoValue(v, t.Elem())
+		if err != nil {
+			return out, err
+		}
+
+		out = reflect.New(t.Elem())
+		out.Elem().Set(e)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			name := structFieldName(t.Field(i))
+			if name == "" || !v.Type().HasAttribute(name) {
+				continue
+			}
+
+			e, err := ctyToGoValue(v.GetAttr(name), t.Field(i).Type)
+			if err != nil {
+				return out, err
+			}
+
+			out.Field(i).Set(e)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() != cty.Number {
+			return out, fmt.Errorf("number required")
+		}
+
+		// numbers are truncated towards zero
+		val, _ := v.AsBigFloat().Int(nil)
+		if val == nil || !val.IsInt64() || out.OverflowInt(val.Int64()) {
+			return out, fmt.Errorf("number %s overflows %s", v.AsBigFloat().Text('g', -1), t)
+		}
+
+		out.SetInt(val.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Type() != cty.Number {
+			return out, fmt.Errorf("number required")
+		}
+
+		val, _ := v.AsBigFloat().Int(nil)
+		if val == nil || !val.IsUint64() || out.OverflowUint(val.Uint64()) {
+			return out, fmt.Errorf("number %s overflows %s", v.AsBigFloat().Text('g', -1), t)
+		}
+
+		out.SetUint(val.Uint64())
+	default:
+		err := gocty.FromCtyValue(v, out.Addr().Interface())
+		if err != nil {
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+// structFieldName returns the name of the field from the hcl or json tag,
+// an empty string is returned for fields that should be ignored
+func structFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("hcl"), ",")[0]
+	if name == "" {
+		name = strings.Split(f.Tag.Get("json"), ",")[0]
+	}
+
+	if name == "-" || !f.IsExported() {
+		return ""
+	}
+
+	return name
+}
+
+// matchPath returns true when the slash separated name matches the pattern, the
+// pattern uses the syntax of path.Match and a ** element matches zero or more
+// directories i.e. **/*.tpl matches config.tpl and templates/nested/config.tpl
+func matchPath(pattern, name string) (bool, error) {
+	elements := strings.Split(pattern, "/")
+	for _, e := range elements {
+		if _, err := path.Match(e, ""); err != nil {
+			return false, err
+		}
+	}
+
+	return matchPathElements(elements, strings.Split(name, "/")), nil
+}
+
+func matchPathElements(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		// try matching the rest of the pattern at every depth
+		for i := 0; i <= len(name); i++ {
+			if matchPathElements(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	// the pattern has been validated so errors can be ignored
+	match, _ := path.Match(pattern[0], name[0])
+	if !match {
+		return false
+	}
+
+	return matchPathElements(pattern[1:], name[1:])
 }
 
 func getDefaultFunctions(filePath string) map[string]function.Function {
@@ -272,13 +411,425 @@ func getDefaultFunctions(filePath string) map[string]function.Function {
 		},
 	})
 
-	funcs := map[string]function.Function{}
+	var FileExistsFunc = function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			fp := ensureAbsolute(args[0].AsString(), filePath)
+
+			s, err := os.Stat(fp)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return cty.False, nil
+				}
+
+				return cty.False, err
+			}
+
+			return cty.BoolVal(s.Mode().IsRegular()), nil
+		},
+	})
+
+	var FileSetFunc = function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "pattern",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Set(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			dir := ensureAbsolute(args[0].AsString(), filePath)
+			pattern := args[1].AsString()
+
+			files := []cty.Value{}
+			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if !info.Mode().IsRegular() {
+					return nil
+				}
+
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+
+				match, err := matchPath(pattern, filepath.ToSlash(rel))
+				if err != nil {
+					return fmt.Errorf("invalid pattern %s: %s", pattern, err)
+				}
+
+				if match {
+					files = append(files, cty.StringVal(filepath.ToSlash(rel)))
+				}
+
+				return nil
+			})
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			if len(files) == 0 {
+				return cty.SetValEmpty(cty.String), nil
+			}
+
+			return cty.SetVal(files), nil
+		},
+	})
+
+	var AbsPathFunc = function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(filepath.ToSlash(ensureAbsolute(args[0].AsString(), filePath))), nil
+		},
+	})
+
+	funcs := getStandardFunctions()
 
 	funcs["len"] = LenFunc
 	funcs["env"] = EnvFunc
 	funcs["home"] = HomeFunc
 	funcs["file"] = ReadFileFunc
 	funcs["dir"] = DirFunc
+	funcs["fileexists"] = FileExistsFunc
+	funcs["fileset"] = FileSetFunc
+	funcs["abspath"] = AbsPathFunc
+	funcs["pathexpand"] = pathExpandFunc
+
+	return funcs
+}
+
+// pathExpandFunc replaces a leading ~ in the given path with the home directory
+// of the current user
+var pathExpandFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "path",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		p := args[0].AsString()
+		if p != "~" && !strings.HasPrefix(p, "~/") {
+			return cty.StringVal(p), nil
+		}
+
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		return cty.StringVal(filepath.Join(h, p[1:])), nil
+	},
+})
+
+// makeTemplateFileFunction creates the templatefile function, templates are
+// rendered using the given functions apart from templatefile to prevent recursion
+func makeTemplateFileFunction(filePath string, funcs map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			fp := ensureAbsolute(args[0].AsString(), filePath)
+
+			src, err := ioutil.ReadFile(fp)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			vars := args[1]
+			if !vars.Type().IsObjectType() && !vars.Type().IsMapType() {
+				return cty.NilVal, fmt.Errorf("template variables must be a map or an object")
+			}
+
+			ctx := &hcl.EvalContext{
+				Variables: map[string]cty.Value{},
+				Functions: map[string]function.Function{},
+			}
+
+			for it := vars.ElementIterator(); it.Next(); {
+				k, v := it.Element()
+				if !hclsyntax.ValidIdentifier(k.AsString()) {
+					return cty.NilVal, fmt.Errorf("template variable %s is not a valid identifier", k.AsString())
+				}
+
+				ctx.Variables[k.AsString()] = v
+			}
+
+			for k, f := range funcs {
+				if k != "templatefile" {
+					ctx.Functions[k] = f
+				}
+			}
+
+			expr, diags := hclsyntax.ParseTemplate(src, fp, hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				return cty.NilVal, fmt.Errorf("unable to parse template %s: %s", fp, diags.Error())
+			}
+
+			val, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				return cty.NilVal, fmt.Errorf("unable to render template %s: %s", fp, diags.Error())
+			}
+
+			val, err = convert.Convert(val, cty.String)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("template %s must produce a string: %s", fp, err)
+			}
+
+			return val, nil
+		},
+	})
+}
+
+// getStandardFunctions returns the string, collection, numeric, encoding,
+// networking and hashing functions that are available in every config
+func getStandardFunctions() map[string]function.Function {
+	funcs := map[string]function.Function{}
+
+	// strings
+	funcs["upper"] = stdlib.UpperFunc
+	funcs["lower"] = stdlib.LowerFunc
+	funcs["title"] = stdlib.TitleFunc
+	funcs["format"] = stdlib.FormatFunc
+	funcs["formatlist"] = stdlib.FormatListFunc
+	funcs["join"] = stdlib.JoinFunc
+	funcs["split"] = stdlib.SplitFunc
+	funcs["replace"] = stdlib.ReplaceFunc
+	funcs["substr"] = stdlib.SubstrFunc
+	funcs["trim"] = stdlib.TrimFunc
+	funcs["trimprefix"] = stdlib.TrimPrefixFunc
+	funcs["trimsuffix"] = stdlib.TrimSuffixFunc
+	funcs["trimspace"] = stdlib.TrimSpaceFunc
+	funcs["indent"] = stdlib.IndentFunc
+	funcs["chomp"] = stdlib.ChompFunc
+	funcs["regex"] = stdlib.RegexFunc
+	funcs["regexall"] = stdlib.RegexAllFunc
+	funcs["regex_replace"] = stdlib.RegexReplaceFunc
+
+	// collections
+	funcs["concat"] = stdlib.ConcatFunc
+	funcs["merge"] = stdlib.MergeFunc
+	funcs["keys"] = stdlib.KeysFunc
+	funcs["values"] = stdlib.ValuesFunc
+	funcs["lookup"] = stdlib.LookupFunc
+	funcs["element"] = stdlib.ElementFunc
+	funcs["flatten"] = stdlib.FlattenFunc
+	funcs["distinct"] = stdlib.DistinctFunc
+	funcs["contains"] = stdlib.ContainsFunc
+	funcs["coalesce"] = stdlib.CoalesceFunc
+	funcs["compact"] = stdlib.CompactFunc
+	funcs["reverse"] = stdlib.ReverseListFunc
+	funcs["slice"] = stdlib.SliceFunc
+	funcs["sort"] = stdlib.SortFunc
+	funcs["range"] = stdlib.RangeFunc
+	funcs["zipmap"] = stdlib.ZipmapFunc
+
+	// numbers
+	funcs["abs"] = stdlib.AbsoluteFunc
+	funcs["min"] = stdlib.MinFunc
+	funcs["max"] = stdlib.MaxFunc
+	funcs["ceil"] = stdlib.CeilFunc
+	funcs["floor"] = stdlib.FloorFunc
+	funcs["pow"] = stdlib.PowFunc
+	funcs["parseint"] = stdlib.ParseIntFunc
+
+	// encoding
+	funcs["jsonencode"] = stdlib.JSONEncodeFunc
+	funcs["jsondecode"] = stdlib.JSONDecodeFunc
+	funcs["csvdecode"] = stdlib.CSVDecodeFunc
+	funcs["yamlencode"] = yamlEncodeFunc
+	funcs["yamldecode"] = yamlDecodeFunc
+	funcs["base64encode"] = base64EncodeFunc
+	funcs["base64decode"] = base64DecodeFunc
+
+	// networking
+	funcs["cidrsubnet"] = cidrSubnetFunc
+	funcs["cidrhost"] = cidrHostFunc
+	funcs["cidrnetmask"] = cidrNetmaskFunc
+	funcs["cidrcontains"] = cidrContainsFunc
+
+	// hashing
+	funcs["md5"] = makeHashFunction(md5.New)
+	funcs["sha1"] = makeHashFunction(sha1.New)
+	funcs["sha256"] = makeHashFunction(sha256.New)
 
 	return funcs
 }
+
+// filterFunctions removes any functions from funcs that are not in allowed
+func filterFunctions(funcs map[string]function.Function, allowed []string) {
+	for k := range funcs {
+		if !containsString(allowed, k) {
+			delete(funcs, k)
+		}
+	}
+}
+
+// yamlEncodeFunc returns the given value encoded as YAML
+var yamlEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:             "value",
+			Type:             cty.DynamicPseudoType,
+			AllowDynamicType: true,
+			AllowNull:        true,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if !args[0].IsWhollyKnown() {
+			return cty.UnknownVal(retType), nil
+		}
+
+		// convert the value to json first so that it can be decoded into
+		// go types understood by the yaml encoder
+		j, err := ctyjson.Marshal(args[0], args[0].Type())
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		var v interface{}
+		err = json.Unmarshal(j, &v)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		y, err := yaml.Marshal(v)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		return cty.StringVal(string(y)), nil
+	},
+})
+
+// yamlDecodeFunc parses the given YAML string and returns the value it represents
+var yamlDecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "src",
+			Type: cty.String,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		if !args[0].IsKnown() {
+			return cty.DynamicPseudoType, nil
+		}
+
+		j, err := yamlToJSON(args[0].AsString())
+		if err != nil {
+			return cty.NilType, err
+		}
+
+		return ctyjson.ImpliedType(j)
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		j, err := yamlToJSON(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		return ctyjson.Unmarshal(j, retType)
+	},
+})
+
+func yamlToJSON(src string) ([]byte, error) {
+	var v interface{}
+	err := yaml.Unmarshal([]byte(src), &v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode yaml: %s", err)
+	}
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert yaml, only maps with string keys are supported: %s", err)
+	}
+
+	return j, nil
+}
+
+// base64EncodeFunc returns the given string encoded using standard base64
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+// base64DecodeFunc decodes the given standard base64 string, the decoded
+// value must be valid UTF-8
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		d, err := base64.StdEncoding.DecodeString(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("unable to decode base64 string: %s", err)
+		}
+
+		if !utf8.Valid(d) {
+			return cty.NilVal, fmt.Errorf("decoded base64 string is not valid UTF-8")
+		}
+
+		return cty.StringVal(string(d)), nil
+	},
+})
+
+// makeHashFunction creates a function that returns the hex encoded hash of a string
+func makeHashFunction(hf func() hash.Hash) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			h := hf()
+			h.Write([]byte(args[0].AsString()))
+
+			return cty.StringVal(hex.EncodeToString(h.Sum(nil))), nil
+		},
+	})
+}
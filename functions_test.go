@@ -2,10 +2,12 @@ package hclconfig
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
 )
 
 func TestCreateFunctionCreatesFunctionWithCorrectInParameters(t *testing.T) {
@@ -76,6 +78,50 @@ func TestCreateFunctionCallsFunction(t *testing.T) {
 	require.Equal(t, int64(5), i)
 }
 
+func TestCreateFunctionTruncatesNumbersForIntegerParameters(t *testing.T) {
+	myfunc := func(a int, b uint, c []int) (int, error) {
+		return a + int(b) + c[0], nil
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	val, err := ctyFunc.Call([]cty.Value{
+		cty.NumberFloatVal(2.7),
+		cty.NumberFloatVal(3.2),
+		cty.ListVal([]cty.Value{cty.NumberFloatVal(-1.9)}),
+	})
+	require.NoError(t, err)
+
+	i, _ := val.AsBigFloat().Int64()
+	require.Equal(t, int64(4), i)
+}
+
+func TestCreateFunctionReturnsErrorWhenIntegerParametersOverflow(t *testing.T) {
+	myfunc := func(a int8, b uint) (int, error) {
+		return int(a) + int(b), nil
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	_, err = ctyFunc.Call([]cty.Value{cty.NumberIntVal(300), cty.NumberIntVal(1)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "number 300 overflows int8")
+
+	argErr, ok := err.(function.ArgError)
+	require.True(t, ok)
+	require.Equal(t, 0, argErr.Index)
+
+	_, err = ctyFunc.Call([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(-1)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "number -1 overflows uint")
+
+	argErr, ok = err.(function.ArgError)
+	require.True(t, ok)
+	require.Equal(t, 1, argErr.Index)
+}
+
 func TestCreateFunctionHandlesInputParams(t *testing.T) {
 	type testCase struct {
 		name string
@@ -158,3 +204,175 @@ func TestCreateFunctionHandlesInputParams(t *testing.T) {
 		})
 	}
 }
+
+func TestYAMLDecodeReturnsObject(t *testing.T) {
+	val, err := yamlDecodeFunc.Call([]cty.Value{cty.StringVal("name: consul\nports:\n  - 8500\n  - 8600\n")})
+	require.NoError(t, err)
+
+	require.Equal(t, "consul", val.GetAttr("name").AsString())
+	require.Equal(t, 2, val.GetAttr("ports").LengthInt())
+}
+
+func TestYAMLDecodeWithInvalidYAMLReturnsError(t *testing.T) {
+	_, err := yamlDecodeFunc.Call([]cty.Value{cty.StringVal("name: [consul")})
+	require.Error(t, err)
+}
+
+func TestBase64DecodeWithInvalidStringReturnsError(t *testing.T) {
+	_, err := base64DecodeFunc.Call([]cty.Value{cty.StringVal("not base64!")})
+	require.Error(t, err)
+}
+
+func TestMatchPathMatchesPatterns(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.tpl", "config.tpl", true},
+		{"*.tpl", "templates/config.tpl", false},
+		{"templates/*.tpl", "templates/config.tpl", true},
+		{"**/*.tpl", "config.tpl", true},
+		{"**/*.tpl", "templates/nested/config.tpl", true},
+		{"templates/**", "templates/nested/config.tpl", true},
+		{"templates/**/config.tpl", "templates/config.tpl", true},
+		{"templates/**/config.tpl", "other/config.tpl", false},
+		{"**", "config.tpl", true},
+	}
+
+	for _, c := range cases {
+		match, err := matchPath(c.pattern, c.name)
+		require.NoError(t, err)
+		require.Equal(t, c.match, match, "pattern %s, name %s", c.pattern, c.name)
+	}
+}
+
+func TestMatchPathWithInvalidPatternReturnsError(t *testing.T) {
+	_, err := matchPath("templates/[", "config.tpl")
+	require.Error(t, err)
+}
+
+func TestFileSetMatchesNestedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.tpl", "")
+	writeTestFile(t, dir, "templates/nested/config.tpl", "")
+	writeTestFile(t, dir, "templates/config.txt", "")
+
+	val, err := getDefaultFunctions(dir)["fileset"].Call([]cty.Value{cty.StringVal(dir), cty.StringVal("**/*.tpl")})
+	require.NoError(t, err)
+	require.Equal(t, cty.SetVal([]cty.Value{cty.StringVal("config.tpl"), cty.StringVal("templates/nested/config.tpl")}), val)
+}
+
+func TestFilterFunctionsRemovesFunctionsNotAllowed(t *testing.T) {
+	funcs := getDefaultFunctions("./")
+	filterFunctions(funcs, []string{"upper", "env"})
+
+	require.Len(t, funcs, 2)
+	require.Contains(t, funcs, "upper")
+	require.Contains(t, funcs, "env")
+}
+
+func TestCreateFunctionHandlesBoolSliceAndMapParameters(t *testing.T) {
+	myfunc := func(upper bool, names []string, tags map[string]int) ([]string, error) {
+		out := []string{}
+		for _, n := range names {
+			if upper {
+				n = strings.ToUpper(n)
+			}
+
+			out = append(out, fmt.Sprintf("%s=%d", n, tags[n]))
+		}
+
+		return out, nil
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	require.Equal(t, cty.Bool, ctyFunc.Params()[0].Type)
+	require.Equal(t, cty.List(cty.String), ctyFunc.Params()[1].Type)
+	require.Equal(t, cty.Map(cty.Number), ctyFunc.Params()[2].Type)
+
+	val, err := ctyFunc.Call([]cty.Value{
+		cty.True,
+		cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		cty.MapVal(map[string]cty.Value{"A": cty.NumberIntVal(1), "B": cty.NumberIntVal(2)}),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, cty.ListVal([]cty.Value{cty.StringVal("A=1"), cty.StringVal("B=2")}), val)
+}
+
+type testFunctionPort struct {
+	Local  int    `hcl:"local"`
+	Remote int    `json:"remote"`
+	Host   string `hcl:"host,optional"`
+
+	ignored string
+}
+
+func TestCreateFunctionHandlesStructs(t *testing.T) {
+	myfunc := func(p testFunctionPort) (*testFunctionPort, error) {
+		p.Local = p.Local + 1
+		p.Host = "localhost"
+
+		return &p, nil
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	objType := cty.Object(map[string]cty.Type{"local": cty.Number, "remote": cty.Number, "host": cty.String})
+	require.Equal(t, objType, ctyFunc.Params()[0].Type)
+
+	val, err := ctyFunc.Call([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"local": cty.NumberIntVal(80), "remote": cty.NumberIntVal(8080), "host": cty.StringVal("")}),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, cty.NumberIntVal(81), val.GetAttr("local"))
+	require.Equal(t, cty.NumberIntVal(8080), val.GetAttr("remote"))
+	require.Equal(t, cty.StringVal("localhost"), val.GetAttr("host"))
+}
+
+func TestCreateFunctionHandlesVariadicParameters(t *testing.T) {
+	myfunc := func(sep string, parts ...string) (string, error) {
+		return strings.Join(parts, sep), nil
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	require.Len(t, ctyFunc.Params(), 1)
+	require.Equal(t, cty.String, ctyFunc.VarParam().Type)
+
+	val, err := ctyFunc.Call([]cty.Value{cty.StringVal("-"), cty.StringVal("a"), cty.StringVal("b"), cty.StringVal("c")})
+	require.NoError(t, err)
+	require.Equal(t, "a-b-c", val.AsString())
+
+	val, err = ctyFunc.Call([]cty.Value{cty.StringVal("-")})
+	require.NoError(t, err)
+	require.Equal(t, "", val.AsString())
+}
+
+func TestCreateFunctionReturnsError(t *testing.T) {
+	myfunc := func(a string) (bool, error) {
+		return false, fmt.Errorf("oops")
+	}
+
+	ctyFunc, err := createCtyFunctionFromGoFunc(myfunc)
+	require.NoError(t, err)
+
+	_, err = ctyFunc.Call([]cty.Value{cty.StringVal("a")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "oops")
+}
+
+func TestCreateFunctionWithInvalidMapKeyReturnsError(t *testing.T) {
+	myfunc := func(a map[int]string) (string, error) {
+		return "", nil
+	}
+
+	_, err := createCtyFunctionFromGoFunc(myfunc)
+	require.Error(t, err)
+}
@@ -48,6 +48,16 @@ func NewGoGetter() Getter {
 	}
 }
 
+// cachePath returns the folder in dest that the source is downloaded to,
+// url characters in src are encoded so that the path is a valid folder
+func cachePath(src, dest string) string {
+	output, _ := filenamify.Filenamify(src, filenamify.Options{
+		Replacement: "_",
+	})
+
+	return path.Join(dest, output)
+}
+
 func (g *GoGetter) Get(src, dest string, ignoreCache bool) (string, error) {
 	// check to see if a folder exists at the destination and exit if exists
 
@@ -56,12 +66,7 @@ func (g *GoGetter) Get(src, dest string, ignoreCache bool) (string, error) {
 		return "", err
 	}
 
-	// ensure the output folder is correctly encoded
-	output, err := filenamify.Filenamify(src, filenamify.Options{
-		Replacement: "_",
-	})
-
-	downloadPath := path.Join(dest, output)
+	downloadPath := cachePath(src, dest)
 
 	// check to see if the destination exists
 	_, err = os.Stat(downloadPath)
@@ -0,0 +1,258 @@
+package hclconfig
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// Graph is the dependency graph for the resources in a config, it is built
+// from the same graph that is used to process the config
+type Graph struct {
+	graph *dag.AcyclicGraph
+
+	// resources in the order they are defined in the config
+	resources []types.Resource
+	index     map[types.Resource]int
+}
+
+// Graph returns the dependency graph for the config, an error is returned
+// if a dependency can not be found or the graph contains a cycle
+func (c *Config) Graph() (*Graph, error) {
+	d, err := doYaLikeDAGs(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create graph: %s", err)
+	}
+
+	err = c.findCycles(d)
+	if err == nil {
+		err = d.Validate()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to validate dependency graph: %w", err)
+	}
+
+	g := &Graph{graph: d, resources: []types.Resource{}, index: map[types.Resource]int{}}
+	for i, r := range c.Resources {
+		g.resources = append(g.resources, r)
+		g.index[r] = i
+	}
+
+	return g, nil
+}
+
+// Resources returns all the resources in the graph
+func (g *Graph) Resources() []types.Resource {
+	return g.resources
+}
+
+// Dependencies returns the resources that r directly depends on, this includes
+// explicit depends_on, links to other resources, and the module r belongs to
+func (g *Graph) Dependencies(r types.Resource) []types.Resource {
+	return g.sorted(g.graph.UpEdges(r).List())
+}
+
+// Dependents returns the resources that directly depend on r
+func (g *Graph) Dependents(r types.Resource) []types.Resource {
+	return g.sorted(g.graph.DownEdges(r).List())
+}
+
+// Roots returns the resources that have no dependencies
+func (g *Graph) Roots() []types.Resource {
+	roots := []types.Resource{}
+
+	for _, r := range g.resources {
+		if len(g.Dependencies(r)) == 0 {
+			roots = append(roots, r)
+		}
+	}
+
+	return roots
+}
+
+// TopologicalOrder returns the resources ordered so that every resource is
+// after its dependencies, resources with no dependency between them are
+// returned in the order they are defined in the config
+func (g *Graph) TopologicalOrder() []types.Resource {
+	remaining := map[types.Resource]int{}
+	for _, r := range g.resources {
+		remaining[r] = len(g.Dependencies(r))
+	}
+
+	order := []types.Resource{}
+	ready := g.Roots()
+
+	for len(ready) > 0 {
+		r := ready[0]
+		ready = ready[1:]
+
+		order = append(order, r)
+
+		for _, d := range g.Dependents(r) {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+
+		sort.SliceStable(ready, func(i, j int) bool { return g.index[ready[i]] < g.index[ready[j]] })
+	}
+
+	return order
+}
+
+// sorted converts a list of vertices to resources in config order, the
+// root node added when building the graph is removed
+func (g *Graph) sorted(vertices []interface{}) []types.Resource {
+	res := []types.Resource{}
+
+	for _, v := range vertices {
+		r, ok := v.(types.Resource)
+		if !ok || isRootModule(r) {
+			continue
+		}
+
+		if _, ok := g.index[r]; ok {
+			res = append(res, r)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return g.index[res[i]] < g.index[res[j]] })
+
+	return res
+}
+
+// moduleTree is a module and its child modules, used to render clusters
+type moduleTree struct {
+	path      string
+	resources []types.Resource
+	children  []*moduleTree
+}
+
+// modules returns the tree of modules, the root of the tree has an empty path
+func (g *Graph) modules() *moduleTree {
+	root := &moduleTree{}
+	trees := map[string]*moduleTree{"": root}
+
+	var find func(path string) *moduleTree
+	find = func(path string) *moduleTree {
+		if t, ok := trees[path]; ok {
+			return t
+		}
+
+		t := &moduleTree{path: path}
+		trees[path] = t
+
+		parent := find(parentModule(path))
+		parent.children = append(parent.children, t)
+
+		return t
+	}
+
+	for _, r := range g.resources {
+		t := find(r.Metadata().Module)
+		t.resources = append(t.resources, r)
+	}
+
+	return root
+}
+
+// DOT returns the graph in Graphviz DOT format. Edges point from a resource to
+// the resources it depends on, resources loaded from modules are grouped in
+// clusters and disabled resources are drawn with a dashed grey outline.
+func (g *Graph) DOT() []byte {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("digraph {\n")
+	buf.WriteString("  compound = \"true\"\n")
+	buf.WriteString("  newrank = \"true\"\n")
+	buf.WriteString("  node [shape = \"box\"]\n")
+
+	g.writeDOTModule(buf, g.modules(), "  ")
+
+	for _, r := range g.resources {
+		for _, d := range g.Dependencies(r) {
+			fmt.Fprintf(buf, "  %q -> %q\n", resourceFQDN(r), resourceFQDN(d))
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+func (g *Graph) writeDOTModule(buf *bytes.Buffer, m *moduleTree, indent string) {
+	for _, r := range m.resources {
+		attrs := fmt.Sprintf("label = %q", r.Metadata().Type+"."+r.Metadata().Name)
+		if r.Metadata().Disabled {
+			attrs += ", style = \"dashed\", color = \"grey\", fontcolor = \"grey\""
+		}
+
+		fmt.Fprintf(buf, "%s%q [%s]\n", indent, resourceFQDN(r), attrs)
+	}
+
+	for _, c := range m.children {
+		fmt.Fprintf(buf, "%ssubgraph %q {\n", indent, "cluster_module."+c.path)
+		fmt.Fprintf(buf, "%s  label = %q\n", indent, "module."+c.path)
+
+		g.writeDOTModule(buf, c, indent+"  ")
+
+		fmt.Fprintf(buf, "%s}\n", indent)
+	}
+}
+
+// Mermaid returns the graph as a Mermaid flowchart. Edges point from a resource
+// to the resources it depends on, resources loaded from modules are grouped in
+// subgraphs and disabled resources are styled with the disabled class.
+func (g *Graph) Mermaid() []byte {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("flowchart TD\n")
+
+	g.writeMermaidModule(buf, g.modules(), "  ")
+
+	for _, r := range g.resources {
+		for _, d := range g.Dependencies(r) {
+			fmt.Fprintf(buf, "  %s --> %s\n", mermaidID(g.index[r]), mermaidID(g.index[d]))
+		}
+	}
+
+	disabled := []string{}
+	for _, r := range g.resources {
+		if r.Metadata().Disabled {
+			disabled = append(disabled, mermaidID(g.index[r]))
+		}
+	}
+
+	if len(disabled) > 0 {
+		buf.WriteString("  classDef disabled stroke-dasharray: 5 5,color:#999\n")
+		fmt.Fprintf(buf, "  class %s disabled\n", strings.Join(disabled, ","))
+	}
+
+	return buf.Bytes()
+}
+
+func (g *Graph) writeMermaidModule(buf *bytes.Buffer, m *moduleTree, indent string) {
+	for _, r := range m.resources {
+		fmt.Fprintf(buf, "%s%s[\"%s.%s\"]\n", indent, mermaidID(g.index[r]), r.Metadata().Type, r.Metadata().Name)
+	}
+
+	for _, c := range m.children {
+		fmt.Fprintf(buf, "%ssubgraph module_%s [\"module.%s\"]\n", indent, strings.ReplaceAll(c.path, ".", "_"), c.path)
+
+		g.writeMermaidModule(buf, c, indent+"  ")
+
+		fmt.Fprintf(buf, "%send\n", indent)
+	}
+}
+
+// mermaidID returns a node id, FQDNs can not be used as they contain
+// characters that are not valid in Mermaid ids
+func mermaidID(i int) string {
+	return fmt.Sprintf("r%d", i)
+}
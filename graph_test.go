@@ -0,0 +1,104 @@
+package hclconfig
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+func setupModuleGraph(t *testing.T) (*Config, *Graph) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/modules/modules.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	g, err := c.Graph()
+	require.NoError(t, err)
+
+	return c, g
+}
+
+func fqdns(res []types.Resource) []string {
+	names := []string{}
+	for _, r := range res {
+		names = append(names, resourceFQDN(r))
+	}
+
+	return names
+}
+
+func TestGraphReturnsDependenciesAndDependents(t *testing.T) {
+	c, g := setupModuleGraph(t)
+
+	base, _ := c.FindResource("resource.container.base")
+	mod, _ := c.FindResource("resource.module.consul_1")
+
+	require.Equal(t, []string{"resource.container.base"}, fqdns(g.Dependencies(mod)))
+	require.Contains(t, fqdns(g.Dependents(base)), "resource.module.consul_1")
+	require.Contains(t, fqdns(g.Dependents(mod)), "module.consul_1.resource.container.consul")
+}
+
+func TestGraphReturnsRoots(t *testing.T) {
+	_, g := setupModuleGraph(t)
+
+	roots := fqdns(g.Roots())
+	require.Contains(t, roots, "resource.container.base")
+	require.Contains(t, roots, "resource.module.consul_2")
+	require.NotContains(t, roots, "resource.module.consul_1")
+}
+
+func TestGraphReturnsTopologicalOrder(t *testing.T) {
+	_, g := setupModuleGraph(t)
+
+	order := g.TopologicalOrder()
+	require.Len(t, order, len(g.Resources()))
+
+	position := map[types.Resource]int{}
+	for i, r := range order {
+		position[r] = i
+	}
+
+	for _, r := range order {
+		for _, d := range g.Dependencies(r) {
+			require.Less(t, position[d], position[r])
+		}
+	}
+}
+
+func TestGraphDOTContainsModuleClusters(t *testing.T) {
+	_, g := setupModuleGraph(t)
+
+	dot := string(g.DOT())
+	require.Contains(t, dot, `subgraph "cluster_module.consul_1" {`)
+	require.Contains(t, dot, `"resource.module.consul_1" -> "resource.container.base"`)
+}
+
+func TestGraphDOTStylesDisabledResources(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/disabled/disabled.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	g, err := c.Graph()
+	require.NoError(t, err)
+
+	require.Contains(t, string(g.DOT()), `"resource.container.disabled" [label = "container.disabled", style = "dashed"`)
+	require.Contains(t, string(g.Mermaid()), "classDef disabled")
+}
+
+func TestGraphMermaidContainsModuleSubgraphs(t *testing.T) {
+	_, g := setupModuleGraph(t)
+
+	m := string(g.Mermaid())
+	require.Contains(t, m, "flowchart TD\n")
+	require.Contains(t, m, `subgraph module_consul_1 ["module.consul_1"]`)
+	require.Contains(t, m, `["container.base"]`)
+}
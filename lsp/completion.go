@@ -0,0 +1,180 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// completion returns the suggestions for the given position, depending on
+// the position this is either block types, attributes and blocks for the
+// enclosing block, or references
+func (s *Server) completion(d *document, pos Position) []CompletionItem {
+	offset := d.offset(pos)
+	prefix := d.prefixAt(offset)
+
+	if strings.Contains(prefix, ".") {
+		return s.referenceCompletion(d, prefix)
+	}
+
+	path := d.blockPath(offset)
+
+	// not inside a block, suggest the registered types
+	if len(path) == 0 {
+		return s.blockTypeCompletion()
+	}
+
+	// values can be references
+	lineStart := strings.LastIndex(d.text[:offset], "\n") + 1
+	if strings.Contains(d.text[lineStart:offset], "=") || path[len(path)-1] == objectMarker {
+		return []CompletionItem{
+			{Label: "resource", Kind: CompletionKindReference, Detail: "reference a resource"},
+			{Label: "var", Kind: CompletionKindReference, Detail: "reference a variable"},
+			{Label: "module", Kind: CompletionKindReference, Detail: "reference a module"},
+		}
+	}
+
+	bs := s.schemaForPath(path)
+	if bs == nil {
+		return []CompletionItem{}
+	}
+
+	return blockContentCompletion(bs)
+}
+
+func (s *Server) blockTypeCompletion() []CompletionItem {
+	items := []CompletionItem{}
+
+	for _, bs := range s.schemas {
+		items = append(items, CompletionItem{
+			Label:         bs.Name,
+			Kind:          CompletionKindClass,
+			Documentation: &MarkupContent{Kind: "markdown", Value: blockDocumentation(bs)},
+		})
+	}
+
+	sortItems(items)
+
+	return items
+}
+
+func blockContentCompletion(bs *types.BlockSchema) []CompletionItem {
+	items := []CompletionItem{}
+
+	for _, a := range bs.Attributes {
+		items = append(items, CompletionItem{
+			Label:         a.Name,
+			Kind:          CompletionKindProperty,
+			Detail:        a.Type,
+			Documentation: &MarkupContent{Kind: "markdown", Value: attributeDocumentation(a)},
+		})
+	}
+
+	for _, b := range bs.Blocks {
+		items = append(items, CompletionItem{
+			Label:         b.Name,
+			Kind:          CompletionKindField,
+			Detail:        "block",
+			Documentation: &MarkupContent{Kind: "markdown", Value: blockDocumentation(b)},
+		})
+	}
+
+	return items
+}
+
+// referenceCompletion completes a partial reference i.e. resource.container.
+func (s *Server) referenceCompletion(d *document, prefix string) []CompletionItem {
+	parts := splitReference(prefix)
+	items := []CompletionItem{}
+
+	switch parts[0] {
+	case "resource":
+		switch len(parts) {
+		case 2:
+			for _, t := range s.resourceTypes(d) {
+				items = append(items, CompletionItem{Label: t, Kind: CompletionKindClass})
+			}
+		case 3:
+			for _, n := range s.resourceNames(d, parts[1]) {
+				items = append(items, CompletionItem{Label: n, Kind: CompletionKindReference, Detail: parts[1]})
+			}
+		default:
+			bs := s.schemaForPath(append([]string{parts[1]}, parts[3:len(parts)-1]...))
+			if bs != nil {
+				items = blockContentCompletion(bs)
+			}
+		}
+	case "var":
+		if len(parts) == 2 {
+			for _, sym := range s.symbols(d) {
+				if sym.Type == types.TypeVariable {
+					items = append(items, CompletionItem{Label: sym.Name, Kind: CompletionKindVariable})
+				}
+			}
+		}
+	case "module":
+		if len(parts) == 2 {
+			for _, sym := range s.symbols(d) {
+				if sym.Type == types.TypeModule {
+					items = append(items, CompletionItem{Label: sym.Name, Kind: CompletionKindModule})
+				}
+			}
+		}
+	}
+
+	sortItems(items)
+
+	return items
+}
+
+func sortItems(items []CompletionItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+}
+
+func blockDocumentation(bs *types.BlockSchema) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("**%s**\n", bs.Name))
+
+	if bs.Description != "" {
+		sb.WriteString("\n" + bs.Description + "\n")
+	}
+
+	if len(bs.Attributes) > 0 {
+		sb.WriteString("\n")
+	}
+
+	for _, a := range bs.Attributes {
+		sb.WriteString(fmt.Sprintf("* `%s` %s%s\n", a.Name, a.Type, requiredText(a.Required)))
+	}
+
+	for _, b := range bs.Blocks {
+		sb.WriteString(fmt.Sprintf("* `%s` block%s\n", b.Name, requiredText(b.Required)))
+	}
+
+	return sb.String()
+}
+
+func attributeDocumentation(a *types.AttributeSchema) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("`%s` %s%s\n", a.Name, a.Type, requiredText(a.Required)))
+
+	if a.Description != "" {
+		sb.WriteString("\n" + a.Description + "\n")
+	}
+
+	if a.Default != "" {
+		sb.WriteString(fmt.Sprintf("\nDefault: `%s`\n", a.Default))
+	}
+
+	return sb.String()
+}
+
+func requiredText(required bool) string {
+	if required {
+		return " (required)"
+	}
+
+	return ""
+}
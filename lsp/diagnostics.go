@@ -0,0 +1,201 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// diagnostics returns syntax errors, schema errors and warnings for
+// references to resources that do not exist
+func (s *Server) diagnostics(d *document) []Diagnostic {
+	diags := []Diagnostic{}
+
+	body, hclDiags := d.parse()
+	for _, hd := range hclDiags {
+		severity := SeverityError
+		if hd.Severity == hcl.DiagWarning {
+			severity = SeverityWarning
+		}
+
+		diag := Diagnostic{Severity: severity, Source: "hclconfig", Message: hd.Summary}
+		if hd.Detail != "" {
+			diag.Message = fmt.Sprintf("%s: %s", hd.Summary, hd.Detail)
+		}
+
+		if hd.Subject != nil {
+			diag.Range = d.toRange(*hd.Subject)
+		}
+
+		diags = append(diags, diag)
+	}
+
+	// errors from the last parse of the config on disk are only reported when
+	// the document is valid as syntax errors would otherwise be reported twice
+	if !hclDiags.HasErrors() {
+		diags = append(diags, s.configDiagnostics(d)...)
+	}
+
+	syms := s.symbols(d)
+
+	for _, b := range body.Blocks {
+		bs, ok := s.schemas[b.Type]
+		if !ok {
+			diags = append(diags, s.newDiagnostic(d, b.TypeRange, SeverityError, "resource type %s is not registered", b.Type))
+			continue
+		}
+
+		if len(b.Labels) == 0 {
+			diags = append(diags, s.newDiagnostic(d, b.TypeRange, SeverityError, "resource '%s' has no name, please specify resources using the syntax 'resource_type \"name\" {}'", b.Type))
+		}
+
+		diags = append(diags, s.validateBody(d, bs, b.Body)...)
+	}
+
+	// check that references point to resources that exist
+	hclsyntax.VisitAll(body, func(n hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || len(expr.Traversal) < 3 || expr.Traversal.RootName() != "resource" {
+			return nil
+		}
+
+		resourceType, ok1 := expr.Traversal[1].(hcl.TraverseAttr)
+		resourceName, ok2 := expr.Traversal[2].(hcl.TraverseAttr)
+		if !ok1 || !ok2 {
+			return nil
+		}
+
+		if _, ok := syms[resourceType.Name+"."+resourceName.Name]; ok {
+			return nil
+		}
+
+		if s.configContains(d, resourceType.Name, resourceName.Name) {
+			return nil
+		}
+
+		diags = append(diags, s.newDiagnostic(d, expr.SrcRange, SeverityWarning, "resource %s.%s is not defined", resourceType.Name, resourceName.Name))
+
+		return nil
+	})
+
+	return diags
+}
+
+// validateBody checks the attributes and blocks of a body against the schema
+func (s *Server) validateBody(d *document, bs *types.BlockSchema, body *hclsyntax.Body) []Diagnostic {
+	diags := []Diagnostic{}
+
+	for name, a := range body.Attributes {
+		if bs.Attribute(name) == nil {
+			diags = append(diags, s.newDiagnostic(d, a.NameRange, SeverityError, "unsupported attribute %s for %s", name, bs.Name))
+		}
+	}
+
+	for _, a := range bs.Attributes {
+		if _, ok := body.Attributes[a.Name]; a.Required && !ok {
+			diags = append(diags, s.newDiagnostic(d, body.SrcRange, SeverityError, "missing required attribute %s for %s", a.Name, bs.Name))
+		}
+	}
+
+	blockCount := map[string]int{}
+
+	for _, b := range body.Blocks {
+		nbs := bs.Block(b.Type)
+		if nbs == nil {
+			diags = append(diags, s.newDiagnostic(d, b.TypeRange, SeverityError, "unsupported block %s for %s", b.Type, bs.Name))
+			continue
+		}
+
+		blockCount[b.Type]++
+		if blockCount[b.Type] > 1 && !nbs.Repeated {
+			diags = append(diags, s.newDiagnostic(d, b.TypeRange, SeverityError, "only one %s block is allowed for %s", b.Type, bs.Name))
+		}
+
+		diags = append(diags, s.validateBody(d, nbs, b.Body)...)
+	}
+
+	for _, nbs := range bs.Blocks {
+		if nbs.Required && blockCount[nbs.Name] == 0 {
+			diags = append(diags, s.newDiagnostic(d, body.SrcRange, SeverityError, "missing required block %s for %s", nbs.Name, bs.Name))
+		}
+	}
+
+	return diags
+}
+
+// errorLocation matches the location of a hcl diagnostic in an error message
+// i.e. /path/main.hcl:4,3-19 or /path/main.hcl:2,17-3,2
+var errorLocation = regexp.MustCompile(`(\S+\.hcl):(\d+),(\d+)-(?:(\d+),)?(\d+)`)
+
+// configDiagnostics converts the error returned when validating the config in
+// the documents directory to diagnostics, errors for other files are ignored
+// and errors without a location are reported at the start of the document
+func (s *Server) configDiagnostics(d *document) []Diagnostic {
+	diags := []Diagnostic{}
+
+	err := s.errors[filepath.Dir(d.path)]
+	if err == nil {
+		return diags
+	}
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		// multiple errors are returned as a list
+		line = strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		if line == "" || strings.HasSuffix(line, "problems:") {
+			continue
+		}
+
+		diag := Diagnostic{Severity: SeverityError, Source: "hclconfig", Message: line}
+
+		if m := errorLocation.FindStringSubmatch(line); m != nil {
+			if filepath.Clean(m[1]) != d.path {
+				continue
+			}
+
+			startLine, _ := strconv.Atoi(m[2])
+			startCol, _ := strconv.Atoi(m[3])
+			endLine := startLine
+			if m[4] != "" {
+				endLine, _ = strconv.Atoi(m[4])
+			}
+			endCol, _ := strconv.Atoi(m[5])
+
+			// the location is shown by the range
+			diag.Message = strings.Replace(line, m[0]+": ", "", 1)
+			diag.Range = Range{
+				Start: Position{Line: startLine - 1, Character: startCol - 1},
+				End:   Position{Line: endLine - 1, Character: endCol - 1},
+			}
+		}
+
+		diags = append(diags, diag)
+	}
+
+	return diags
+}
+
+func (s *Server) configContains(d *document, resourceType, name string) bool {
+	c, ok := s.configs[filepath.Dir(d.path)]
+	if !ok {
+		return false
+	}
+
+	_, err := c.FindResource(fmt.Sprintf("resource.%s.%s", resourceType, name))
+
+	return err == nil
+}
+
+func (s *Server) newDiagnostic(d *document, r hcl.Range, severity int, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Range:    d.toRange(r),
+		Severity: severity,
+		Source:   "hclconfig",
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,201 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+// objectMarker is added to a block path when the position is inside an
+// object expression i.e. env = { ... } rather than a block
+const objectMarker = "{}"
+
+// document is a text document that has been opened by the client
+type document struct {
+	uri  string
+	path string
+	text string
+}
+
+func newDocument(uri, text string) *document {
+	return &document{uri: uri, path: uriToPath(uri), text: text}
+}
+
+// parse returns the syntax tree for the document, the body is returned
+// even when the document contains errors
+func (d *document) parse() (*hclsyntax.Body, hcl.Diagnostics) {
+	f, diags := hclsyntax.ParseConfig([]byte(d.text), d.path, hcl.Pos{Line: 1, Column: 1, Byte: 0})
+
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return &hclsyntax.Body{}, diags
+	}
+
+	return body, diags
+}
+
+// offset converts a LSP position into a byte offset in the document
+func (d *document) offset(p Position) int {
+	line := 0
+	i := 0
+
+	for line < p.Line && i < len(d.text) {
+		if d.text[i] == '\n' {
+			line++
+		}
+
+		i++
+	}
+
+	// character is a count of UTF-16 code units
+	units := 0
+	for i < len(d.text) && units < p.Character {
+		r, size := utf8.DecodeRuneInString(d.text[i:])
+		if r == '\n' {
+			break
+		}
+
+		units += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+
+	return i
+}
+
+// position converts a byte offset in the document into a LSP position
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+
+	p := Position{}
+	for _, r := range d.text[:offset] {
+		if r == '\n' {
+			p.Line++
+			p.Character = 0
+			continue
+		}
+
+		p.Character += len(utf16.Encode([]rune{r}))
+	}
+
+	return p
+}
+
+func (d *document) toRange(r hcl.Range) Range {
+	return Range{Start: d.position(r.Start.Byte), End: d.position(r.End.Byte)}
+}
+
+// blockPath returns the types of the blocks that enclose the given offset
+// i.e. [container, volume]. The lexer is used rather than the parser so that
+// the path can be determined for incomplete documents.
+func (d *document) blockPath(offset int) []string {
+	tokens, _ := hclsyntax.LexConfig([]byte(d.text), d.path, hcl.Pos{Line: 1, Column: 1, Byte: 0})
+
+	path := []string{}
+	header := []hclsyntax.Token{}
+
+	for _, t := range tokens {
+		if t.Range.Start.Byte >= offset {
+			break
+		}
+
+		switch t.Type {
+		case hclsyntax.TokenNewline:
+			header = header[:0]
+		case hclsyntax.TokenOBrace:
+			path = append(path, blockType(header))
+			header = header[:0]
+		case hclsyntax.TokenCBrace:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+
+			header = header[:0]
+		default:
+			header = append(header, t)
+		}
+	}
+
+	return path
+}
+
+// blockType returns the type from the tokens preceding an open brace,
+// if the tokens are part of an expression the object marker is returned
+func blockType(header []hclsyntax.Token) string {
+	if len(header) == 0 || header[0].Type != hclsyntax.TokenIdent {
+		return objectMarker
+	}
+
+	for _, t := range header {
+		if t.Type == hclsyntax.TokenEqual || t.Type == hclsyntax.TokenColon {
+			return objectMarker
+		}
+	}
+
+	return string(header[0].Bytes)
+}
+
+// traversalAt returns the reference, i.e. resource.container.base.dns,
+// that contains the given offset along with the start and end offset
+func (d *document) traversalAt(offset int) (string, int, int) {
+	start := offset
+	for start > 0 && isTraversalChar(d.text[start-1]) {
+		start--
+	}
+
+	// references can not start with an index i.e. [resource.container.base]
+	for start < offset && (d.text[start] == '[' || d.text[start] == ']') {
+		start++
+	}
+
+	end := offset
+	for end < len(d.text) && isTraversalChar(d.text[end]) {
+		end++
+	}
+
+	// remove the closing bracket of a list i.e. [resource.container.base.dns]
+	for end > start && d.text[end-1] == ']' && strings.Count(d.text[start:end], "[") < strings.Count(d.text[start:end], "]") {
+		end--
+	}
+
+	return strings.Trim(d.text[start:end], "."), start, end
+}
+
+// prefixAt returns the partial reference typed before the given offset
+func (d *document) prefixAt(offset int) string {
+	start := offset
+	for start > 0 && isTraversalChar(d.text[start-1]) {
+		start--
+	}
+
+	for start < offset && (d.text[start] == '[' || d.text[start] == ']') {
+		start++
+	}
+
+	return d.text[start:offset]
+}
+
+func isTraversalChar(c byte) bool {
+	return c == '.' || c == '_' || c == '-' || c == '[' || c == ']' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
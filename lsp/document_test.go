@@ -0,0 +1,44 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetAndPositionAreSymmetric(t *testing.T) {
+	d := newDocument("file:///tmp/test.hcl", "container \"base\" {\n  command = [\"é\", \"a\"]\n}\n")
+
+	p := Position{Line: 1, Character: 19}
+	o := d.offset(p)
+
+	require.Equal(t, byte('a'), d.text[o])
+	require.Equal(t, p, d.position(o))
+}
+
+func TestBlockPathReturnsEnclosingBlocks(t *testing.T) {
+	d := newDocument("file:///tmp/test.hcl", `
+container "base" {
+  env = {
+    a = "b"
+  }
+
+  volume {
+    source = "${var.dir}"
+  }
+}
+`)
+
+	require.Equal(t, []string{}, d.blockPath(0))
+	require.Equal(t, []string{"container"}, d.blockPath(d.offset(Position{Line: 2, Character: 0})))
+	require.Equal(t, []string{"container", objectMarker}, d.blockPath(d.offset(Position{Line: 3, Character: 4})))
+	require.Equal(t, []string{"container", "volume"}, d.blockPath(d.offset(Position{Line: 7, Character: 24})))
+}
+
+func TestTraversalAtReturnsReference(t *testing.T) {
+	d := newDocument("file:///tmp/test.hcl", `dns = [resource.container.base.network[0].name]`)
+
+	ref, _, _ := d.traversalAt(20)
+	require.Equal(t, "resource.container.base.network[0].name", ref)
+	require.Equal(t, []string{"resource", "container", "base", "network", "name"}, splitReference(ref))
+}
@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// hover returns the documentation for the block type, attribute or
+// reference at the given position
+func (s *Server) hover(d *document, pos Position) *Hover {
+	offset := d.offset(pos)
+
+	// is this a reference
+	if ref, start, end := d.traversalAt(offset); ref != "" {
+		if sym, attr := s.findReference(d, ref); sym != nil {
+			content := fmt.Sprintf("**%s** `%s`\n", sym.Type, sym.Name)
+			if attr != nil {
+				content += "\n" + attributeDocumentation(attr)
+			}
+
+			rng := Range{Start: d.position(start), End: d.position(end)}
+			return &Hover{Contents: markdown(content), Range: &rng}
+		}
+	}
+
+	body, _ := d.parse()
+
+	return s.hoverBody(d, body, []string{}, offset)
+}
+
+func (s *Server) hoverBody(d *document, body *hclsyntax.Body, path []string, offset int) *Hover {
+	for _, a := range body.Attributes {
+		if !contains(a.NameRange.Start.Byte, a.NameRange.End.Byte, offset) {
+			continue
+		}
+
+		bs := s.schemaForPath(path)
+		if bs == nil {
+			return nil
+		}
+
+		if as := bs.Attribute(a.Name); as != nil {
+			rng := d.toRange(a.NameRange)
+			return &Hover{Contents: markdown(attributeDocumentation(as)), Range: &rng}
+		}
+
+		return nil
+	}
+
+	for _, b := range body.Blocks {
+		blockPath := append(append([]string{}, path...), b.Type)
+
+		if contains(b.TypeRange.Start.Byte, b.TypeRange.End.Byte, offset) {
+			bs := s.schemaForPath(blockPath)
+			if bs == nil {
+				return nil
+			}
+
+			rng := d.toRange(b.TypeRange)
+			return &Hover{Contents: markdown(blockDocumentation(bs)), Range: &rng}
+		}
+
+		if contains(b.OpenBraceRange.Start.Byte, b.CloseBraceRange.End.Byte, offset) {
+			return s.hoverBody(d, b.Body, blockPath, offset)
+		}
+	}
+
+	return nil
+}
+
+// definition returns the location of the block referenced at the given position
+func (s *Server) definition(d *document, pos Position) *Location {
+	ref, _, _ := d.traversalAt(d.offset(pos))
+	if ref == "" {
+		return nil
+	}
+
+	sym, _ := s.findReference(d, ref)
+	if sym == nil {
+		return nil
+	}
+
+	return &Location{
+		URI:   sym.doc.uri,
+		Range: Range{Start: sym.doc.position(sym.start), End: sym.doc.position(sym.end)},
+	}
+}
+
+// findReference returns the symbol and the schema of the attribute referenced
+// by ref i.e. resource.container.base.dns or var.cpu
+func (s *Server) findReference(d *document, ref string) (*symbol, *types.AttributeSchema) {
+	parts := splitReference(ref)
+	if len(parts) < 2 {
+		return nil, nil
+	}
+
+	key := ""
+	switch parts[0] {
+	case "resource":
+		if len(parts) < 3 {
+			return nil, nil
+		}
+
+		key = parts[1] + "." + parts[2]
+	case "var":
+		key = types.TypeVariable + "." + parts[1]
+	case "module":
+		key = types.TypeModule + "." + parts[1]
+	default:
+		return nil, nil
+	}
+
+	sym, ok := s.symbols(d)[key]
+	if !ok {
+		return nil, nil
+	}
+
+	// find the schema for the referenced attribute
+	if parts[0] != "resource" || len(parts) < 4 {
+		return sym, nil
+	}
+
+	bs := s.schemaForPath(append([]string{parts[1]}, parts[3:len(parts)-1]...))
+	if bs == nil {
+		return sym, nil
+	}
+
+	return sym, bs.Attribute(parts[len(parts)-1])
+}
+
+func contains(start, end, offset int) bool {
+	return offset >= start && offset < end
+}
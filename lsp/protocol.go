@@ -0,0 +1,231 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes used by the language server protocol
+const (
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// message is a JSON-RPC 2.0 request, response or notification
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// conn reads and writes JSON-RPC messages framed with a Content-Length header
+type conn struct {
+	r *bufio.Reader
+	w io.Writer
+	m sync.Mutex
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: bufio.NewReader(r), w: w}
+}
+
+func (c *conn) read() (*message, error) {
+	length := -1
+
+	// read the headers
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header: %s", err)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message does not contain a Content-Length header")
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(c.r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &message{}
+	err = json.Unmarshal(body, msg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode message: %s", err)
+	}
+
+	return msg, nil
+}
+
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+
+	d, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(d), d)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result interface{}) error {
+	// a null result must still be sent so that the client can
+	// match the response to the request
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return c.write(&message{ID: id, Result: result})
+}
+
+func (c *conn) replyError(id *json.RawMessage, code int, msg string) error {
+	return c.write(&message{ID: id, Error: &responseError{Code: code, Message: msg}})
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	d, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.write(&message{Method: method, Params: d})
+}
+
+// Position in a text document expressed as zero-based line and
+// zero-based UTF-16 character offset
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range in a text document
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location inside a resource
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Diagnostic severities
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Diagnostic represents a compiler error or warning
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Completion item kinds
+const (
+	CompletionKindField     = 5
+	CompletionKindVariable  = 6
+	CompletionKindClass     = 7
+	CompletionKindModule    = 9
+	CompletionKindProperty  = 10
+	CompletionKindReference = 18
+)
+
+// CompletionItem is a single suggestion returned for a completion request
+type CompletionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *MarkupContent `json:"documentation,omitempty"`
+}
+
+// MarkupContent is markdown content displayed by the client
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the result of a hover request
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI     string `json:"uri"`
+	Text    string `json:"text"`
+	Version int    `json:"version"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type didSaveParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+func markdown(s string) MarkupContent {
+	return MarkupContent{Kind: "markdown", Value: s}
+}
@@ -0,0 +1,399 @@
+/*
+Package lsp implements a language server for configuration parsed by hclconfig.
+
+The server provides completion of block types, attributes and references,
+hover documentation, go to definition for references and variables and
+live diagnostics. Products built on hclconfig get editor support by
+providing a function that returns a parser with their types registered.
+
+	s := lsp.NewServer(func() *hclconfig.Parser {
+		p := hclconfig.NewParser(hclconfig.DefaultOptions())
+		p.RegisterType("container", &Container{})
+
+		return p
+	})
+
+	err := s.Serve(os.Stdin, os.Stdout)
+
+The parser returned by the function is used to validate the configuration
+in the workspace every time a file is opened, changed or saved, open files
+are validated using their contents in the editor. The configuration is
+parsed but not processed, the Callback and the Process method of resources
+are not called, remote modules are not fetched and the State is not used.
+Errors returned by the parser are published as diagnostics.
+*/
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/shipyard-run/hclconfig"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// Server is a language server for hclconfig based configuration
+type Server struct {
+	newParser func() *hclconfig.Parser
+	schemas   map[string]*types.BlockSchema
+	documents map[string]*document
+	configs   map[string]*hclconfig.Config
+	errors    map[string]error
+	conn      *conn
+	shutdown  bool
+}
+
+// NewServer creates a new language server, newParser is called to create a
+// parser with the products types and functions registered
+func NewServer(newParser func() *hclconfig.Parser) *Server {
+	s := &Server{
+		newParser: newParser,
+		schemas:   map[string]*types.BlockSchema{},
+		documents: map[string]*document{},
+		configs:   map[string]*hclconfig.Config{},
+		errors:    map[string]error{},
+	}
+
+	for _, bs := range newParser().Schemas() {
+		s.schemas[bs.Name] = bs
+	}
+
+	return s
+}
+
+// Serve reads requests from r and writes responses to w until the
+// client sends the exit notification or r is closed
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		err = s.handle(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	// requests have an id and expect a response, notifications do not
+	if msg.ID != nil && s.shutdown && msg.Method != "shutdown" {
+		return s.conn.replyError(msg.ID, codeInvalidRequest, "server is shutting down")
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return s.conn.reply(msg.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    1, // full document sync
+					"save":      true,
+				},
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]interface{}{
+				"name": "hclconfig",
+			},
+		})
+	case "shutdown":
+		s.shutdown = true
+		return s.conn.reply(msg.ID, nil)
+	case "textDocument/didOpen":
+		p := didOpenParams{}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil
+		}
+
+		d := newDocument(p.TextDocument.URI, p.TextDocument.Text)
+		s.documents[d.uri] = d
+		s.parseConfig(filepath.Dir(d.path))
+
+		return s.publishDiagnostics(d)
+	case "textDocument/didChange":
+		p := didChangeParams{}
+		if err := json.Unmarshal(msg.Params, &p); err != nil || len(p.ContentChanges) == 0 {
+			return nil
+		}
+
+		// full sync, the last change contains the whole document
+		d := newDocument(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		s.documents[d.uri] = d
+		s.parseConfig(filepath.Dir(d.path))
+
+		return s.publishDiagnostics(d)
+	case "textDocument/didSave":
+		p := didSaveParams{}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil
+		}
+
+		if d, ok := s.documents[p.TextDocument.URI]; ok {
+			s.parseConfig(filepath.Dir(d.path))
+			return s.publishDiagnostics(d)
+		}
+
+		return nil
+	case "textDocument/didClose":
+		p := didCloseParams{}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil
+		}
+
+		delete(s.documents, p.TextDocument.URI)
+
+		// clear the diagnostics for the closed document
+		return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		p := textDocumentPositionParams{}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return s.conn.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+
+		d, ok := s.documents[p.TextDocument.URI]
+		if !ok {
+			return s.conn.reply(msg.ID, nil)
+		}
+
+		switch msg.Method {
+		case "textDocument/completion":
+			return s.conn.reply(msg.ID, s.completion(d, p.Position))
+		case "textDocument/hover":
+			if h := s.hover(d, p.Position); h != nil {
+				return s.conn.reply(msg.ID, h)
+			}
+		case "textDocument/definition":
+			if l := s.definition(d, p.Position); l != nil {
+				return s.conn.reply(msg.ID, l)
+			}
+		}
+
+		return s.conn.reply(msg.ID, nil)
+	}
+
+	// unknown notifications are ignored, unknown requests return an error
+	if msg.ID != nil {
+		return s.conn.replyError(msg.ID, codeMethodNotFound, "method not supported: "+msg.Method)
+	}
+
+	return nil
+}
+
+// parseConfig validates the configuration in the given directory using the
+// products parser, the resources are not processed. Open documents are
+// validated in place of the files on disk so that changes are reported
+// before they are saved. The error is kept so that it can be reported in
+// the diagnostics for the documents in dir.
+func (s *Server) parseConfig(dir string) {
+	c := hclconfig.NewConfig()
+
+	sources := map[string][]byte{}
+	for _, d := range s.documents {
+		sources[d.path] = []byte(d.text)
+	}
+
+	p := s.newParser()
+	s.errors[dir] = p.ValidateDirectoryWithSources(dir, sources, c)
+
+	s.configs[dir] = c
+}
+
+func (s *Server) publishDiagnostics(d *document) error {
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Diagnostics: s.diagnostics(d),
+	})
+}
+
+// workspaceDocuments returns the open documents and the hcl files on disk
+// that are in the same directory as the given document, open documents
+// take precedence over the files on disk
+func (s *Server) workspaceDocuments(d *document) []*document {
+	dir := filepath.Dir(d.path)
+	docs := []*document{}
+	seen := map[string]bool{}
+
+	for _, od := range s.documents {
+		if filepath.Dir(od.path) == dir {
+			docs = append(docs, od)
+			seen[od.path] = true
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.hcl"))
+	for _, f := range files {
+		if seen[f] {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+
+		docs = append(docs, newDocument(pathToURI(f), string(data)))
+	}
+
+	return docs
+}
+
+// symbol is a block defined in the workspace
+type symbol struct {
+	Type  string
+	Name  string
+	doc   *document
+	start int
+	end   int
+}
+
+// symbols returns all the top level blocks defined in the workspace,
+// keyed by type.name
+func (s *Server) symbols(d *document) map[string]*symbol {
+	syms := map[string]*symbol{}
+
+	for _, wd := range s.workspaceDocuments(d) {
+		body, _ := wd.parse()
+
+		for _, b := range body.Blocks {
+			if len(b.Labels) == 0 {
+				continue
+			}
+
+			syms[b.Type+"."+b.Labels[0]] = &symbol{
+				Type:  b.Type,
+				Name:  b.Labels[0],
+				doc:   wd,
+				start: b.TypeRange.Start.Byte,
+				end:   b.LabelRanges[0].End.Byte,
+			}
+		}
+	}
+
+	return syms
+}
+
+// resourceNames returns the names of the resources with the given type
+// that are defined in the workspace or the parsed config
+func (s *Server) resourceNames(d *document, resourceType string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+
+	add := func(n string) {
+		if !seen[n] {
+			names = append(names, n)
+			seen[n] = true
+		}
+	}
+
+	for _, sym := range s.symbols(d) {
+		if resourceType == "" || sym.Type == resourceType {
+			add(sym.Name)
+		}
+	}
+
+	if c, ok := s.configs[filepath.Dir(d.path)]; ok {
+		for _, r := range c.Resources {
+			if r.Metadata().Module != "" {
+				continue
+			}
+
+			if r.Metadata().Type == resourceType {
+				add(r.Metadata().Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// resourceTypes returns the types of the resources that are defined in
+// the workspace or the parsed config
+func (s *Server) resourceTypes(d *document) []string {
+	typeNames := []string{}
+	seen := map[string]bool{}
+
+	add := func(t string) {
+		if t == types.TypeVariable || t == types.TypeModule || seen[t] {
+			return
+		}
+
+		typeNames = append(typeNames, t)
+		seen[t] = true
+	}
+
+	for _, sym := range s.symbols(d) {
+		add(sym.Type)
+	}
+
+	if c, ok := s.configs[filepath.Dir(d.path)]; ok {
+		for _, r := range c.Resources {
+			if r.Metadata().Module == "" {
+				add(r.Metadata().Type)
+			}
+		}
+	}
+
+	return typeNames
+}
+
+// schemaForPath returns the schema for the block at the given path
+// i.e. [container, volume]
+func (s *Server) schemaForPath(path []string) *types.BlockSchema {
+	if len(path) == 0 {
+		return nil
+	}
+
+	bs, ok := s.schemas[path[0]]
+	if !ok {
+		return nil
+	}
+
+	for _, p := range path[1:] {
+		if p == objectMarker {
+			return nil
+		}
+
+		bs = bs.Block(p)
+		if bs == nil {
+			return nil
+		}
+	}
+
+	return bs
+}
+
+// splitReference splits a reference into its parts ignoring any indexes
+// i.e. resource.container.base.network[0].name
+func splitReference(ref string) []string {
+	parts := strings.Split(ref, ".")
+	for i, p := range parts {
+		if n := strings.Index(p, "["); n > -1 {
+			parts[i] = p[:n]
+		}
+	}
+
+	return parts
+}
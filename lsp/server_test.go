@@ -0,0 +1,351 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig"
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/stretchr/testify/require"
+)
+
+var testNetwork = `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+variable "cpu" {
+  default = 1024
+}
+`
+
+var testContainer = `
+container "base" {
+  command = ["consul"]
+
+  network {
+    name = resource.network.onprem.name
+  }
+
+  resources {
+    cpu = var.cpu
+  }
+}
+`
+
+// client is a test client that sends requests to the server
+type client struct {
+	t     *testing.T
+	conn  *conn
+	id    int
+	notes []*message
+}
+
+func setupServer(t *testing.T, files map[string]string) (*client, string) {
+	dir := t.TempDir()
+
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	s := NewServer(func() *hclconfig.Parser {
+		p := hclconfig.NewParser(hclconfig.DefaultOptions())
+		p.RegisterType("container", &structs.Container{})
+		p.RegisterType("network", &structs.Network{})
+
+		return p
+	})
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	go func() {
+		s.Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	t.Cleanup(func() {
+		clientOut.Close()
+	})
+
+	c := &client{t: t, conn: newConn(clientIn, clientOut)}
+	c.call("initialize", map[string]interface{}{}, nil)
+
+	return c, dir
+}
+
+// call sends a request and decodes the result into result, any
+// notifications received before the response are stored
+func (c *client) call(method string, params interface{}, result interface{}) {
+	c.id++
+
+	id := json.RawMessage(strconv.Itoa(c.id))
+	d, err := json.Marshal(params)
+	require.NoError(c.t, err)
+
+	err = c.conn.write(&message{ID: &id, Method: method, Params: d})
+	require.NoError(c.t, err)
+
+	for {
+		msg, err := c.conn.read()
+		require.NoError(c.t, err)
+
+		if msg.ID == nil {
+			c.notes = append(c.notes, msg)
+			continue
+		}
+
+		require.Nil(c.t, msg.Error)
+
+		if result != nil {
+			// the result is decoded as a generic value, re-encode to convert
+			r, _ := json.Marshal(msg.Result)
+			err := json.Unmarshal(r, result)
+			require.NoError(c.t, err)
+		}
+
+		return
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	err := c.conn.notify(method, params)
+	require.NoError(c.t, err)
+}
+
+// open opens a document and returns the published diagnostics
+func (c *client) open(uri, text string) []Diagnostic {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "text": text, "version": 1},
+	})
+
+	msg, err := c.conn.read()
+	require.NoError(c.t, err)
+	require.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+
+	p := publishDiagnosticsParams{}
+	err = json.Unmarshal(msg.Params, &p)
+	require.NoError(c.t, err)
+
+	return p.Diagnostics
+}
+
+func positionParams(uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": char},
+	}
+}
+
+func labels(items []CompletionItem) []string {
+	l := []string{}
+	for _, i := range items {
+		l = append(l, i.Label)
+	}
+
+	return l
+}
+
+func TestCompletionReturnsBlockTypes(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	c.open(uri, "\n")
+
+	items := []CompletionItem{}
+	c.call("textDocument/completion", positionParams(uri, 0, 0), &items)
+
+	require.Contains(t, labels(items), "container")
+	require.Contains(t, labels(items), "network")
+	require.Contains(t, labels(items), "module")
+}
+
+func TestCompletionReturnsAttributesAndBlocks(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	c.open(uri, testContainer)
+
+	// inside the container block
+	items := []CompletionItem{}
+	c.call("textDocument/completion", positionParams(uri, 3, 0), &items)
+
+	require.Contains(t, labels(items), "command")
+	require.Contains(t, labels(items), "volume")
+	require.Contains(t, labels(items), "depends_on")
+
+	// inside the resources block
+	c.call("textDocument/completion", positionParams(uri, 9, 0), &items)
+
+	require.Contains(t, labels(items), "cpu_pin")
+	require.NotContains(t, labels(items), "command")
+}
+
+func TestCompletionReturnsReferences(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	c.open(uri, `
+container "base" {
+  command = [resource.]
+  dns = [resource.network.]
+  entrypoint = [resource.network.onprem.]
+  privileged = var.
+}
+`)
+
+	items := []CompletionItem{}
+	c.call("textDocument/completion", positionParams(uri, 2, 22), &items)
+	require.Contains(t, labels(items), "network")
+	require.Contains(t, labels(items), "container")
+
+	c.call("textDocument/completion", positionParams(uri, 3, 26), &items)
+	require.Equal(t, []string{"onprem"}, labels(items))
+
+	c.call("textDocument/completion", positionParams(uri, 4, 40), &items)
+	require.Contains(t, labels(items), "subnet")
+
+	c.call("textDocument/completion", positionParams(uri, 5, 19), &items)
+	require.Equal(t, []string{"cpu"}, labels(items))
+}
+
+func TestHoverReturnsAttributeDocumentation(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	c.open(uri, testContainer)
+
+	h := &Hover{}
+	c.call("textDocument/hover", positionParams(uri, 2, 4), h)
+	require.Contains(t, h.Contents.Value, "`command` list(string)")
+
+	c.call("textDocument/hover", positionParams(uri, 1, 2), h)
+	require.Contains(t, h.Contents.Value, "**container**")
+
+	c.call("textDocument/hover", positionParams(uri, 5, 22), h)
+	require.Contains(t, h.Contents.Value, "**network** `onprem`")
+}
+
+func TestDefinitionReturnsLocationOfReference(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	c.open(uri, testContainer)
+
+	l := &Location{}
+	c.call("textDocument/definition", positionParams(uri, 5, 22), l)
+	require.Equal(t, pathToURI(filepath.Join(dir, "network.hcl")), l.URI)
+	require.Equal(t, 1, l.Range.Start.Line)
+
+	c.call("textDocument/definition", positionParams(uri, 9, 14), l)
+	require.Equal(t, pathToURI(filepath.Join(dir, "network.hcl")), l.URI)
+	require.Equal(t, 5, l.Range.Start.Line)
+}
+
+func TestDiagnosticsReportsSchemaErrors(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	diags := c.open(uri, `
+container "base" {
+  unknown = "abc"
+
+  network {
+    ip_address = "10.6.0.2"
+  }
+
+  dns = [resource.network.missing.name]
+}
+
+database "db" {
+}
+`)
+
+	messages := []string{}
+	for _, d := range diags {
+		messages = append(messages, d.Message)
+	}
+
+	require.Contains(t, messages, "unsupported attribute unknown for container")
+	require.Contains(t, messages, "missing required attribute name for network")
+	require.Contains(t, messages, "resource network.missing is not defined")
+	require.Contains(t, messages, "resource type database is not registered")
+}
+
+func TestDiagnosticsReportsSyntaxErrors(t *testing.T) {
+	c, dir := setupServer(t, map[string]string{})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	diags := c.open(uri, `container "base" {`)
+
+	require.NotEmpty(t, diags)
+	require.Equal(t, SeverityError, diags[0].Severity)
+}
+
+func TestDiagnosticsReportsConfigErrors(t *testing.T) {
+	container := `
+container "base" {
+  command = ["consul"]
+
+  resources {
+    cpu = var.missing
+  }
+}
+`
+
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork, "container.hcl": container})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	diags := c.open(uri, container)
+
+	require.NotEmpty(t, diags)
+	require.Equal(t, SeverityError, diags[0].Severity)
+	require.Equal(t, `Unsupported attribute; This object does not have an attribute named "missing".`, diags[0].Message)
+	require.Equal(t, Range{Start: Position{Line: 5, Character: 13}, End: Position{Line: 5, Character: 21}}, diags[0].Range)
+}
+
+func TestDiagnosticsReportsConfigErrorsForChangedDocument(t *testing.T) {
+	container := `
+container "base" {
+  command = ["consul"]
+}
+`
+
+	c, dir := setupServer(t, map[string]string{"network.hcl": testNetwork, "container.hcl": container})
+	uri := pathToURI(filepath.Join(dir, "container.hcl"))
+
+	diags := c.open(uri, container)
+	require.Empty(t, diags)
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{
+			{"text": `
+container "base" {
+  command = ["consul"]
+
+  resources {
+    cpu = var.missing
+  }
+}
+`},
+		},
+	})
+
+	msg, err := c.conn.read()
+	require.NoError(t, err)
+	require.Equal(t, "textDocument/publishDiagnostics", msg.Method)
+
+	p := publishDiagnosticsParams{}
+	err = json.Unmarshal(msg.Params, &p)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, p.Diagnostics)
+	require.Equal(t, `Unsupported attribute; This object does not have an attribute named "missing".`, p.Diagnostics[0].Message)
+	require.Equal(t, Range{Start: Position{Line: 5, Character: 13}, End: Position{Line: 5, Character: 21}}, p.Diagnostics[0].Range)
+}
@@ -1,17 +1,22 @@
 package hclconfig
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
 	"github.com/shipyard-run/hclconfig/types"
 	"github.com/stretchr/testify/require"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
 )
 
 func setupParser(t *testing.T, options ...*ParserOptions) (*Config, *Parser) {
@@ -324,6 +329,118 @@ func TestParseProcessesDefaultFunctions(t *testing.T) {
 	require.Contains(t, cont.Env["dir"], filepath.Dir(absoluteFolderPath))
 }
 
+func TestParseProcessesStandardFunctions(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/functions/stdlib.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.base")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, []string{"CONSUL", "AGENT", "-DEV"}, cont.Command)
+	require.Equal(t, "consul-1", cont.Env["format"])
+	require.Equal(t, "a,b,c", cont.Env["join"])
+	require.Equal(t, "a_b", cont.Env["replace"])
+	require.Equal(t, "123", cont.Env["regex"])
+	require.Equal(t, `{"a":1,"b":2}`, cont.Env["merge"])
+	require.Equal(t, "a,b", cont.Env["keys"])
+	require.Equal(t, "default", cont.Env["lookup"])
+	require.Equal(t, "3", cont.Env["flatten"])
+	require.Equal(t, "2", cont.Env["distinct"])
+	require.Equal(t, "true", cont.Env["contains"])
+	require.Equal(t, "1", cont.Env["min"])
+	require.Equal(t, "2", cont.Env["ceil"])
+	require.Equal(t, "json", cont.Env["jsondecode"])
+	require.Equal(t, "a: yaml\n", cont.Env["yamlencode"])
+	require.Equal(t, "yaml", cont.Env["yamldecode"])
+	require.Equal(t, "consul", cont.Env["base64"])
+	require.Equal(t, "b713f0bd8f48dfad2263cabc455ade78f7e4e99a548101f31f935686dff67124", cont.Env["sha256"])
+	require.Equal(t, "3d2e6bded046ca2e3f906f04235b279b", cont.Env["md5"])
+}
+
+func TestParseWithAllowedFunctionsRestrictsFunctions(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/functions/stdlib.hcl")
+	require.NoError(t, err)
+
+	o := DefaultOptions()
+	o.AllowedFunctions = []string{"upper", "split"}
+
+	c, p := setupParser(t, o)
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Call to unknown function")
+}
+
+func TestParseProcessesFilesystemFunctions(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/filesystem/main.hcl")
+	require.NoError(t, err)
+
+	home, _ := os.UserHomeDir()
+
+	c, p := setupParser(t)
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.base")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, filepath.Join(filepath.Dir(absoluteFolderPath), "templates", "config.tpl"), cont.Command[3])
+	require.Equal(t, "name = \"ROOT\"\nport = 8500\nport = 8600\n", cont.Env["template"])
+	require.Equal(t, "true", cont.Env["exists"])
+	require.Equal(t, "false", cont.Env["not_exists"])
+	require.Equal(t, "templates/config.tpl", cont.Env["fileset"])
+	require.Equal(t, filepath.Join(home, ".shipyard"), cont.Env["home"])
+
+	// functions in modules resolve paths relative to the module
+	r, err = c.FindResource("module.sub.resource.container.sub")
+	require.NoError(t, err)
+
+	cont = r.(*structs.Container)
+
+	require.Equal(t, "module = \"module\"\n", cont.Env["template"])
+	require.Equal(t, "true", cont.Env["exists"])
+}
+
+func TestParseProcessesNetworkingFunctionsAfterDependencies(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/networking/network.hcl")
+	require.NoError(t, err)
+
+	order := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		order = append(order, resourceFQDN(r))
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	requireBefore(t, "resource.network.onprem", "resource.container.consul", order)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, "10.6.0.200", cont.Networks[0].IPAddress)
+	require.Equal(t, "10.6.2.0/24", cont.Env["subnet"])
+	require.Equal(t, "255.255.0.0", cont.Env["netmask"])
+	require.Equal(t, "true", cont.Env["contains"])
+}
+
 func TestParseProcessesCustomFunctions(t *testing.T) {
 	absoluteFolderPath, err := filepath.Abs("./test_fixtures/functions/custom.hcl")
 	if err != nil {
@@ -331,7 +448,8 @@ func TestParseProcessesCustomFunctions(t *testing.T) {
 	}
 
 	c, p := setupParser(t)
-	p.RegisterFunction("constant_number", func() (int, error) { return 42, nil })
+	err = p.RegisterFunction("constant_number", func() (int, error) { return 42, nil })
+	require.NoError(t, err)
 
 	err = p.ParseFile(absoluteFolderPath, c)
 	require.NoError(t, err)
@@ -344,6 +462,85 @@ func TestParseProcessesCustomFunctions(t *testing.T) {
 	require.Equal(t, "42", cont.Env["len"])
 }
 
+func TestParseProcessesCustomFunctionsWithCollections(t *testing.T) {
+	file := CreateTestFile(t, `
+container "base" {
+  command = prefix("consul", "agent", "-dev")
+
+  env = {
+    "enabled" = enabled({ consul = true, vault = false }, "consul")
+  }
+}
+`)
+
+	c, p := setupParser(t)
+	err := p.RegisterFunction("prefix", func(name string, args ...string) ([]string, error) {
+		return append([]string{name}, args...), nil
+	})
+	require.NoError(t, err)
+
+	err = p.RegisterFunction("enabled", func(services map[string]bool, name string) (bool, error) {
+		return services[name], nil
+	})
+	require.NoError(t, err)
+
+	err = p.ParseFile(file, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.base")
+	require.NoError(t, err)
+
+	cont := r.(*structs.Container)
+
+	require.Equal(t, []string{"consul", "agent", "-dev"}, cont.Command)
+	require.Equal(t, "true", cont.Env["enabled"])
+}
+
+func TestRegisterFunctionWithUnsupportedSignatureReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterFunction("invalid", func(f func()) (int, error) { return 0, nil })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to register function invalid")
+
+	err = p.RegisterFunction("invalid", func() (int, string) { return 0, "" })
+	require.Error(t, err)
+
+	err = p.RegisterFunction("invalid", "not a function")
+	require.Error(t, err)
+
+	require.NotContains(t, p.registeredFunctions, "invalid")
+}
+
+func TestRegisterCtyFunctionWithInvalidNameReturnsError(t *testing.T) {
+	_, p := setupParser(t)
+
+	err := p.RegisterCtyFunction("my func", stdlib.UpperFunc)
+	require.Error(t, err)
+}
+
+func TestParseProcessesCtyFunctions(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/functions/custom.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+	err = p.RegisterCtyFunction("constant_number", function.New(&function.Spec{
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.NumberIntVal(7), nil
+		},
+	}))
+	require.NoError(t, err)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.base")
+	require.NoError(t, err)
+
+	require.Equal(t, "7", r.(*structs.Container).Env["len"])
+}
+
 func TestSetContextVariableFromPath(t *testing.T) {
 	ctx := &hcl.EvalContext{}
 	ctx.Variables = map[string]cty.Value{"resource": cty.ObjectVal(map[string]cty.Value{})}
@@ -424,3 +621,352 @@ func requireBefore(t *testing.T, first, second string, list []string) {
 
 	require.Greater(t, pos2, pos1, fmt.Sprintf("expected %s to be created before %s. calls: %v", first, second, list))
 }
+
+func TestJSONSchemaContainsRegisteredTypes(t *testing.T) {
+	_, p := setupParser(t)
+
+	s, err := p.JSONSchema()
+	require.NoError(t, err)
+
+	require.Contains(t, string(s), `"container"`)
+	require.Contains(t, string(s), `"network"`)
+	require.Contains(t, string(s), `"template"`)
+}
+
+func parseWithTargets(t *testing.T, file string, targets []string, includeDependents bool) (*Config, []string) {
+	absoluteFolderPath, err := filepath.Abs(file)
+	require.NoError(t, err)
+
+	called := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Targets = targets
+	o.IncludeDependents = includeDependents
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		called = append(called, resourceFQDN(r))
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	return c, called
+}
+
+func TestParseWithTargetsProcessesTargetAndDependencies(t *testing.T) {
+	c, called := parseWithTargets(t, "./test_fixtures/simple/container.hcl", []string{"resource.container.base"}, false)
+
+	require.ElementsMatch(t, []string{"resource.network.onprem", "resource.container.base"}, called)
+
+	// untargeted resources are not decoded
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Nil(t, r.(*structs.Container).Command)
+}
+
+func TestParseWithTargetsIncludesDependents(t *testing.T) {
+	_, called := parseWithTargets(t, "./test_fixtures/simple/container.hcl", []string{"resource.container.base"}, true)
+
+	require.ElementsMatch(t, []string{"resource.network.onprem", "resource.container.base", "resource.container.consul"}, called)
+}
+
+func TestParseWithModuleTargetProcessesModuleResources(t *testing.T) {
+	_, called := parseWithTargets(t, "./test_fixtures/modules/modules.hcl", []string{"module.consul_2"}, false)
+
+	require.Contains(t, called, "resource.module.consul_2")
+	require.Contains(t, called, "module.consul_2.resource.container.consul")
+	require.Contains(t, called, "module.consul_2.resource.network.onprem")
+	require.NotContains(t, called, "resource.container.base")
+	require.NotContains(t, called, "module.consul_1.resource.container.consul")
+}
+
+func TestParseWithUnknownTargetReturnsError(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/simple/container.hcl")
+	require.NoError(t, err)
+
+	o := DefaultOptions()
+	o.Targets = []string{"resource.container.missing"}
+
+	c, p := setupParser(t, o)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.Error(t, err)
+}
+
+func TestParseWithContextPassesContextToCallback(t *testing.T) {
+	type key string
+
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/simple/container.hcl")
+	require.NoError(t, err)
+
+	values := []interface{}{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.CallbackWithContext = func(ctx context.Context, r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		values = append(values, ctx.Value(key("test")))
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	ctx := context.WithValue(context.Background(), key("test"), "abc")
+	err = p.ParseFileWithContext(ctx, absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, values)
+	for _, v := range values {
+		require.Equal(t, "abc", v)
+	}
+}
+
+func TestParseWithContextStopsProcessingWhenCancelled(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/simple/container.hcl")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	called := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		called = append(called, resourceFQDN(r))
+
+		// cancel once the network has been processed
+		if r.Metadata().Type == structs.TypeNetwork {
+			cancel()
+		}
+
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err = p.ParseFileWithContext(ctx, absoluteFolderPath, c)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// containers depend on the network so should not be processed
+	require.NotContains(t, called, "resource.container.base")
+	require.NotContains(t, called, "resource.container.consul")
+}
+
+func TestParseWithMaxConcurrencyLimitsParallelism(t *testing.T) {
+	resources := ""
+	for i := 0; i < 10; i++ {
+		resources += fmt.Sprintf("network \"net_%d\" {\n  subnet = \"10.%d.0.0/16\"\n}\n", i, i)
+	}
+
+	running := 0
+	max := 0
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.MaxConcurrency = 2
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, resources), c)
+	require.NoError(t, err)
+	require.LessOrEqual(t, max, 2)
+	require.Greater(t, max, 0)
+}
+
+func TestParseSendsEvents(t *testing.T) {
+	file := CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "disabled" {
+  disabled = true
+}
+`)
+
+	events := map[string][]EventType{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error { return nil }
+	o.OnEvent = func(e Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		events[e.FQDN] = append(events[e.FQDN], e.Type)
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(file, c)
+	require.NoError(t, err)
+
+	// network implements Processable
+	require.Equal(t, []EventType{
+		EventScheduled,
+		EventDecodeStarted,
+		EventDecodeFinished,
+		EventProcessStarted,
+		EventProcessFinished,
+		EventCallbackFinished,
+	}, events["resource.network.onprem"])
+
+	require.Equal(t, []EventType{EventScheduled, EventSkippedDisabled}, events["resource.container.disabled"])
+}
+
+func TestParseSendsFailedEvent(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/simple/container.hcl")
+	require.NoError(t, err)
+
+	failed := []Event{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		if r.Metadata().Type == structs.TypeNetwork {
+			return fmt.Errorf("boom")
+		}
+
+		return nil
+	}
+
+	o.OnEvent = func(e Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if e.Type == EventFailed {
+			failed = append(failed, e)
+		}
+	}
+
+	c, p := setupParser(t, o)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.Error(t, err)
+
+	require.Len(t, failed, 1)
+	require.Equal(t, "resource.network.onprem", failed[0].FQDN)
+	require.Contains(t, failed[0].Error.Error(), "boom")
+	require.Greater(t, int64(failed[0].Duration), int64(0))
+}
+
+func TestValidateFileDecodesResourcesWithoutProcessing(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	p, called := setupStateParser(t, statePath)
+
+	c := NewConfig()
+	err := p.ValidateFile(CreateTestFile(t, stateConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, "10.6.0.0/16", r.(*structs.Container).Volumes[0].Source)
+
+	require.Empty(t, *called)
+	require.NoFileExists(t, statePath)
+	require.NoFileExists(t, statePath+".lock")
+}
+
+func TestValidateFileReturnsErrorForInvalidReference(t *testing.T) {
+	c, p := setupParser(t)
+
+	err := p.ValidateFile(CreateTestFile(t, `
+container "consul" {
+  command = [resource.network.missing.name]
+}
+`), c)
+	require.Error(t, err)
+}
+
+func TestValidateFileDoesNotFetchRemoteModules(t *testing.T) {
+	o := DefaultOptions()
+	o.ModuleCache = t.TempDir()
+
+	c, p := setupParser(t, o)
+
+	err := p.ValidateFile(CreateTestFile(t, `
+module "consul" {
+  source = "github.com/shipyard-run/hclconfig?ref=main/test_fixtures/single"
+}
+`), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "has not been fetched")
+
+	files, _ := ioutil.ReadDir(o.ModuleCache)
+	require.Empty(t, files)
+}
+
+func TestValidateDirectoryWithSourcesReplacesFilesOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "network.hcl", `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+`)
+	writeTestFile(t, dir, "container.hcl", `
+container "consul" {
+  command = ["consul"]
+
+  volume {
+    source      = resource.network.missing.subnet
+    destination = "/data"
+  }
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ValidateDirectoryWithSources(dir, map[string][]byte{
+		filepath.Join(dir, "container.hcl"): []byte(`
+container "consul" {
+  command = ["consul"]
+
+  volume {
+    source      = resource.network.onprem.subnet
+    destination = "/data"
+  }
+}
+`),
+		filepath.Join(dir, "unsaved.hcl"): []byte(`
+network "dev" {
+  subnet = "10.7.0.0/16"
+}
+`),
+	}, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, "10.6.0.0/16", r.(*structs.Container).Volumes[0].Source)
+
+	_, err = c.FindResource("resource.network.dev")
+	require.NoError(t, err)
+}
@@ -1,6 +1,8 @@
 package hclconfig
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -10,6 +12,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -40,6 +43,79 @@ type ParserOptions struct {
 	VariableEnvPrefix string
 	ModuleCache       string
 	Callback          ProcessCallback
+
+	// CallbackWithContext is the context aware version of Callback, the context
+	// is the context passed to ParseFileWithContext or ParseDirectoryWithContext.
+	// When both are set only CallbackWithContext is called.
+	CallbackWithContext ProcessCallbackWithContext
+
+	// RetryPolicies define the retries and timeouts used when processing
+	// resources, keyed by resource type i.e. container or by resource FQDN
+	// i.e. resource.container.consul. Policies for a FQDN override policies for
+	// a type, values set in a resources lifecycle block override both
+	RetryPolicies map[string]RetryPolicy
+
+	// OnEvent is called to report the progress of processing each resource
+	OnEvent EventCallback
+
+	// MaxConcurrency limits the number of resources that are processed in
+	// parallel, when 0 there is no limit
+	MaxConcurrency int
+
+	// State is the backend used to store the state of processed resources,
+	// when set the state is loaded before the config is processed and saved
+	// after all resources have been processed successfully
+	State StateBackend
+
+	// SkipUnchanged does not call the Callback for resources that have not
+	// changed since the state was last saved, requires State
+	SkipUnchanged bool
+
+	// Targets limits processing to the resources with the given FQDNs i.e.
+	// resource.container.consul or module.consul and their dependencies. Resources
+	// that are not targeted are parsed but are not decoded, processed, or passed to
+	// the Callback
+	Targets []string
+
+	// IncludeDependents also processes the resources that depend on the Targets
+	IncludeDependents bool
+
+	// AllowedFunctions restricts the built in functions that can be used in a config,
+	// when empty all the built in functions are available. Functions registered with
+	// RegisterFunction are always available
+	AllowedFunctions []string
+
+	// Deterministic returns an error when a config calls an impure function, i.e.
+	// env or a function registered with the Impure option, unless the function
+	// has a value in PinnedFunctions
+	Deterministic bool
+
+	// PinnedFunctions replaces functions with a fixed value, the function returns
+	// the value regardless of the arguments it is called with
+	PinnedFunctions map[string]cty.Value
+
+	// ModuleFunctions restricts the functions that can be called in a module,
+	// keyed by the module name i.e. consul or consul.vault for a nested module.
+	// Values are function names or globs i.e. net__*, a nested module can only
+	// call functions that are allowed by its parents
+	ModuleFunctions map[string][]string
+
+	// FileSandbox restricts the files that can be read by the file, templatefile,
+	// fileexists, and fileset functions to the given directories, paths that
+	// resolve outside of the directories after following symlinks return an
+	// error. Remote modules can only read files in their own directory in the
+	// ModuleCache whether or not FileSandbox is set
+	FileSandbox []string
+
+	// AllowedEnv restricts the environment variables that can be read by env to
+	// the given names or globs i.e. APP_*, reading any other variable returns an
+	// error. Variables with the VariableEnvPrefix that are not allowed are ignored.
+	// When empty all variables can be read
+	AllowedEnv []string
+
+	// RequireEnv returns an error when env reads a variable that is not set
+	// rather than returning an empty string
+	RequireEnv bool
 }
 
 // DefaultOptions returns a ParserOptions object with the
@@ -66,7 +142,25 @@ type Parser struct {
 	options             ParserOptions
 	registeredTypes     types.RegisteredTypes
 	registeredFunctions map[string]function.Function
+	impureFunctions     map[string]bool
+	configFunctions     map[string]ConfigFunction
 	config              *Config
+
+	// contextModules are the modules that each context was built for
+	contextModules map[*hcl.EvalContext]string
+
+	// variableFunctions records the functions called to set the variables
+	variableFunctions variableFunctions
+
+	// env records the environment variables read by the current parse
+	env *envRecorder
+
+	// validating is true when the config is being validated rather than processed
+	validating bool
+
+	// sources replace the contents of the files on disk when validating, keyed
+	// by the path of the file
+	sources map[string][]byte
 }
 
 // NewParser creates a new parser with the given options
@@ -77,7 +171,19 @@ func NewParser(options *ParserOptions) *Parser {
 		o = DefaultOptions()
 	}
 
-	return &Parser{options: *o, registeredTypes: types.DefaultTypes(), registeredFunctions: map[string]function.Function{}}
+	p := &Parser{
+		options:             *o,
+		registeredTypes:     types.DefaultTypes(),
+		registeredFunctions: map[string]function.Function{},
+		impureFunctions:     map[string]bool{},
+		configFunctions:     map[string]ConfigFunction{},
+	}
+
+	for _, f := range defaultImpureFunctions {
+		p.impureFunctions[f] = true
+	}
+
+	return p
 }
 
 // RegisterType type registers a struct that implements Resource with the given name
@@ -89,19 +195,85 @@ func (p *Parser) RegisterType(name string, resource types.Resource) {
 // RegisterFunction type registers a custom interpolation function
 // with the given name
 // the parser uses this list to convert hcl defined resources into concrete types
-func (p *Parser) RegisterFunction(name string, f interface{}) error {
+// an error is returned when the signature of the function is not supported
+func (p *Parser) RegisterFunction(name string, f interface{}, opts ...FunctionOption) error {
 	ctyFunc, err := createCtyFunctionFromGoFunc(f)
 	if err != nil {
-		return nil
+		return fmt.Errorf("unable to register function %s: %s", name, err)
 	}
 
-	p.registeredFunctions[name] = ctyFunc
+	return p.RegisterCtyFunction(name, ctyFunc, opts...)
+}
+
+// RegisterCtyFunction registers a custom interpolation function that has been
+// created using the go-cty function package, this can be used when a function
+// can not be expressed as a Go function i.e. it has a dynamic return type
+func (p *Parser) RegisterCtyFunction(name string, f function.Function, opts ...FunctionOption) error {
+	o := &functionOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	name, err := p.functionName(name, o)
+	if err != nil {
+		return err
+	}
+
+	p.registeredFunctions[name] = f
+	p.impureFunctions[name] = o.impure
 
 	return nil
 }
 
+// RegisteredTypes returns the types that have been registered with the parser
+func (p *Parser) RegisteredTypes() types.RegisteredTypes {
+	return p.registeredTypes
+}
+
+// Schemas returns the schema for every registered type, the schema
+// describes the attributes and blocks that can be set for a resource
+func (p *Parser) Schemas() []*types.BlockSchema {
+	return p.registeredTypes.Schemas()
+}
+
+// JSONSchema returns a JSON Schema document that describes every registered
+// type, this can be used by editors for autocompletion or to validate
+// configuration written using the HCL JSON syntax
+func (p *Parser) JSONSchema() ([]byte, error) {
+	return p.registeredTypes.JSONSchema()
+}
+
+// ParseJSON creates a new config from JSON serialized with Config.MarshalJSON,
+// resources are decoded into the types registered with the parser
+func (p *Parser) ParseJSON(d []byte) (*Config, error) {
+	c := NewConfig()
+	c.registeredTypes = p.registeredTypes
+
+	err := json.Unmarshal(d, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
 func (p *Parser) ParseFile(file string, c *Config) error {
-	rootContext = buildContext(file, p.registeredFunctions)
+	return p.ParseFileWithContext(context.Background(), file, c)
+}
+
+// ParseFileWithContext parses the given file, once ctx is cancelled no new
+// resources are processed and the error wraps ctx.Err()
+func (p *Parser) ParseFileWithContext(ctx context.Context, file string, c *Config) error {
+	c.registeredTypes = p.registeredTypes
+	c.impureFunctions = p.unpinnedImpureFunctions()
+	c.configFunctions = p.allowedConfigFunctions()
+	p.config = c
+	p.contextModules = map[*hcl.EvalContext]string{}
+	p.env = newEnvRecorder()
+	c.env = p.env
+	p.variableFunctions = variableFunctions{}
+	c.variableFunctions = p.variableFunctions
+	rootContext = p.buildContext(file, "")
 
 	err := p.parseFile(rootContext, file, c, p.options.Variables, p.options.VariablesFiles)
 	if err != nil {
@@ -109,14 +281,29 @@ func (p *Parser) ParseFile(file string, c *Config) error {
 	}
 
 	// process the files and resolve dependency
-	return c.process(p.options.Callback)
+	return p.process(ctx, c)
 }
 
 // ParseDirectory parses all resource and variable files in the given directory
 // note: this method does not recurse into sub folders
 func (p *Parser) ParseDirectory(dir string, c *Config) error {
+	return p.ParseDirectoryWithContext(context.Background(), dir, c)
+}
+
+// ParseDirectoryWithContext parses all resource and variable files in the given
+// directory, once ctx is cancelled no new resources are processed and the error
+// wraps ctx.Err()
+func (p *Parser) ParseDirectoryWithContext(ctx context.Context, dir string, c *Config) error {
 	p.config = c
-	rootContext = buildContext(dir, p.registeredFunctions)
+	c.registeredTypes = p.registeredTypes
+	c.impureFunctions = p.unpinnedImpureFunctions()
+	c.configFunctions = p.allowedConfigFunctions()
+	p.contextModules = map[*hcl.EvalContext]string{}
+	p.env = newEnvRecorder()
+	c.env = p.env
+	p.variableFunctions = variableFunctions{}
+	c.variableFunctions = p.variableFunctions
+	rootContext = p.buildContext(dir, "")
 
 	c, err := p.parseDirectory(rootContext, dir, c)
 	if err != nil {
@@ -124,7 +311,118 @@ func (p *Parser) ParseDirectory(dir string, c *Config) error {
 	}
 
 	// process the files and resolve dependency
-	return c.process(p.options.Callback)
+	return p.process(ctx, c)
+}
+
+// ValidateFile parses and decodes the resources in the given file without processing
+// them, it returns the same errors as ParseFile for invalid references, variables and
+// dependency cycles. Process and the Callback are not called, remote modules that
+// are not in the ModuleCache are not fetched, and the State is not read or written
+func (p *Parser) ValidateFile(file string, c *Config) error {
+	p.validating = true
+	defer func() { p.validating = false }()
+
+	return p.ParseFile(file, c)
+}
+
+// ValidateDirectory parses and decodes the resources in the given directory without
+// processing them, see ValidateFile
+func (p *Parser) ValidateDirectory(dir string, c *Config) error {
+	p.validating = true
+	defer func() { p.validating = false }()
+
+	return p.ParseDirectory(dir, c)
+}
+
+// ValidateDirectoryWithSources validates the configuration in the given directory like
+// ValidateDirectory, sources replace the contents of the files with the same path
+// allowing configuration that has not been saved to be validated. Sources in dir
+// that do not exist on disk are validated as if they did.
+func (p *Parser) ValidateDirectoryWithSources(dir string, sources map[string][]byte, c *Config) error {
+	p.sources = map[string][]byte{}
+	for fn, src := range sources {
+		p.sources[filepath.Clean(fn)] = src
+	}
+	defer func() { p.sources = nil }()
+
+	return p.ValidateDirectory(dir, c)
+}
+
+// callback returns the callback to call for each resource
+func (p *Parser) callback() ProcessCallbackWithContext {
+	if p.options.CallbackWithContext != nil {
+		return p.options.CallbackWithContext
+	}
+
+	if p.options.Callback != nil {
+		return func(ctx context.Context, r types.Resource) error {
+			return p.options.Callback(r)
+		}
+	}
+
+	return nil
+}
+
+// process walks the config calling the callback for each resource, when state
+// is enabled the state is locked for the duration of the walk and saved on success
+func (p *Parser) process(ctx context.Context, c *Config) error {
+	c.onEvent = p.options.OnEvent
+	c.retryPolicies = p.options.RetryPolicies
+	defer func() { c.onEvent = nil }()
+
+	c.setConfigFunctionDependencies()
+
+	if len(p.options.Targets) > 0 {
+		err := c.setTargets(p.options.Targets, p.options.IncludeDependents)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.validating {
+		return c.validate(ctx)
+	}
+
+	if p.options.State == nil {
+		return c.process(ctx, p.callback(), p.options.MaxConcurrency)
+	}
+
+	err := p.options.State.Lock()
+	if err != nil {
+		return err
+	}
+
+	defer p.options.State.Unlock()
+
+	previous, err := p.options.State.Load()
+	if err != nil {
+		return err
+	}
+
+	c.states = newResourceStates(previous, p.options.SkipUnchanged)
+
+	cb := p.callback()
+	if cb != nil && p.options.SkipUnchanged {
+		cb = func(ctx context.Context, r types.Resource) error {
+			if c.Unchanged(r) {
+				return nil
+			}
+
+			return p.callback()(ctx, r)
+		}
+	}
+
+	err = c.process(ctx, cb, p.options.MaxConcurrency)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.newState()
+	if err != nil {
+		return err
+	}
+
+	return p.options.State.Save(s)
 }
 
 // internal method
@@ -158,22 +456,58 @@ func (p *Parser) parseDirectory(ctx *hcl.EvalContext, dir string, c *Config) (*C
 		}
 	}
 
+	hclFiles := []string{}
 	for _, f := range files {
 		fn := filepath.Join(dir, f.Name())
 
 		if !f.IsDir() {
 			if strings.HasSuffix(fn, ".hcl") {
-				err := p.parseFile(ctx, fn, c, p.options.Variables, variablesFiles)
-				if err != nil {
-					return nil, err
-				}
+				hclFiles = append(hclFiles, fn)
 			}
 		}
 	}
 
+	hclFiles = append(hclFiles, p.unsavedSources(dir, hclFiles)...)
+
+	for _, fn := range hclFiles {
+		err := p.parseFile(ctx, fn, c, p.options.Variables, variablesFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
+// unsavedSources returns the hcl sources in dir that are not in files
+func (p *Parser) unsavedSources(dir string, files []string) []string {
+	saved := map[string]bool{}
+	for _, f := range files {
+		saved[f] = true
+	}
+
+	unsaved := []string{}
+	for fn := range p.sources {
+		if filepath.Dir(fn) == filepath.Clean(dir) && strings.HasSuffix(fn, ".hcl") && !saved[fn] {
+			unsaved = append(unsaved, fn)
+		}
+	}
+
+	sort.Strings(unsaved)
+
+	return unsaved
+}
+
+// parseHCLFile parses the given file, the source replaces the file on disk
+// when one has been set
+func (p *Parser) parseHCLFile(parser *hclparse.Parser, file string) (*hcl.File, hcl.Diagnostics) {
+	if src, ok := p.sources[file]; ok {
+		return parser.ParseHCL(src, file)
+	}
+
+	return parser.ParseHCLFile(file)
+}
+
 // parseFile loads variables and resources from the given file
 func (p *Parser) parseFile(
 	ctx *hcl.EvalContext,
@@ -212,16 +546,18 @@ func (p *Parser) parseFile(
 func (p *Parser) loadVariablesFromFile(ctx *hcl.EvalContext, path string) error {
 	parser := hclparse.NewParser()
 
-	f, diag := parser.ParseHCLFile(path)
+	f, diag := p.parseHCLFile(parser, path)
 	if diag.HasErrors() {
 		return errors.New(diag.Error())
 	}
 
 	attrs, _ := f.Body.JustAttributes()
 	for name, attr := range attrs {
-		val, _ := attr.Expr.Value(ctx)
+		val, env := p.env.evaluate(ctx, attr.Expr)
 
 		setContextVariable(ctx, name, val)
+		p.variableFunctions.set(ctx, name, p.variableFunctions.expressionFunctions(ctx, attr.Expr))
+		p.env.setVariable(ctx, name, env)
 	}
 
 	return nil
@@ -236,8 +572,14 @@ func (p *Parser) setVariables(ctx *hcl.EvalContext, vars map[string]string) {
 			parts := strings.Split(e, "=")
 
 			if len(parts) == 2 {
+				if !p.envAllowed(parts[0]) {
+					continue
+				}
+
 				key := strings.Replace(parts[0], p.options.VariableEnvPrefix, "", -1)
 				setContextVariable(ctx, key, valueFromString(parts[1]))
+				p.variableFunctions.set(ctx, key, []string{"env"})
+				p.env.setVariable(ctx, key, []string{parts[0]})
 			}
 		}
 	}
@@ -245,6 +587,8 @@ func (p *Parser) setVariables(ctx *hcl.EvalContext, vars map[string]string) {
 	// then set vars
 	for k, v := range vars {
 		setContextVariable(ctx, k, valueFromString(v))
+		p.variableFunctions.set(ctx, k, nil)
+		p.env.setVariable(ctx, k, nil)
 	}
 }
 
@@ -266,7 +610,7 @@ func valueFromString(v string) cty.Value {
 func (p *Parser) parseVariablesInFile(ctx *hcl.EvalContext, file string, c *Config) error {
 	parser := hclparse.NewParser()
 
-	f, diag := parser.ParseHCLFile(file)
+	f, diag := p.parseHCLFile(parser, file)
 	if diag.HasErrors() {
 		return errors.New(diag.Error())
 	}
@@ -287,8 +631,15 @@ func (p *Parser) parseVariablesInFile(ctx *hcl.EvalContext, file string, c *Conf
 				return err
 			}
 
-			val, _ := v.Default.(*hcl.Attribute).Expr.Value(ctx)
+			expr := v.Default.(*hcl.Attribute).Expr
+			val, env := p.env.evaluate(ctx, expr)
 			setContextVariableIfMissing(ctx, v.Name, val)
+			p.variableFunctions.setIfMissing(ctx, v.Name, p.variableFunctions.expressionFunctions(ctx, expr))
+			p.env.setVariableIfMissing(ctx, v.Name, env)
+
+			p.recordVariableEnv(ctx, v.Name)
+
+			c.addVariable(b)
 		}
 	}
 
@@ -299,7 +650,7 @@ func (p *Parser) parseVariablesInFile(ctx *hcl.EvalContext, file string, c *Conf
 func (p *Parser) parseResourcesInFile(ctx *hcl.EvalContext, file string, c *Config, moduleName string, disabled bool, dependsOn []string) error {
 	parser := hclparse.NewParser()
 
-	f, diag := parser.ParseHCLFile(file)
+	f, diag := p.parseHCLFile(parser, file)
 	if diag.HasErrors() {
 		return errors.New(diag.Error())
 	}
@@ -309,6 +660,8 @@ func (p *Parser) parseResourcesInFile(ctx *hcl.EvalContext, file string, c *Conf
 		return errors.New("Error getting body")
 	}
 
+	c.addSource(file, f.Bytes)
+
 	for _, b := range body.Blocks {
 		// check the resource has a name
 		if len(b.Labels) == 0 {
@@ -342,6 +695,42 @@ func (p *Parser) parseResourcesInFile(ctx *hcl.EvalContext, file string, c *Conf
 	return nil
 }
 
+// setDependsOn adds the resources defined in the depends_on attribute to the
+// resources dependencies, this needs to be done before the graph is built
+// as resources are not decoded until they are processed
+func setDependsOn(ctx *hcl.EvalContext, r types.Resource, b *hclsyntax.Body) error {
+	attr, ok := b.Attributes["depends_on"]
+	if !ok {
+		return nil
+	}
+
+	val, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() {
+		return fmt.Errorf("unable to read depends_on: %s", diags.Error())
+	}
+
+	if !val.CanIterateElements() {
+		return fmt.Errorf("depends_on must be a list of resources")
+	}
+
+	// copy the dependencies as the slice is shared by all resources in a module
+	deps := append([]string{}, r.Metadata().DependsOn...)
+
+	for _, v := range val.AsValueSlice() {
+		if v.Type() != cty.String || !v.IsKnown() || v.IsNull() {
+			return fmt.Errorf("depends_on must be a list of resources")
+		}
+
+		if !containsString(deps, v.AsString()) {
+			deps = append(deps, v.AsString())
+		}
+	}
+
+	r.Metadata().DependsOn = deps
+
+	return nil
+}
+
 func setDisabled(ctx *hcl.EvalContext, r types.Resource, b *hclsyntax.Body, parentDisabled bool) error {
 	if parentDisabled {
 		r.Metadata().Disabled = true
@@ -361,6 +750,27 @@ func setDisabled(ctx *hcl.EvalContext, r types.Resource, b *hclsyntax.Body, pare
 	return nil
 }
 
+// fetchModule downloads a remote module to the ModuleCache and returns the
+// path, when validating remote modules are not downloaded and must already
+// be in the cache
+func (p *Parser) fetchModule(src string) (string, error) {
+	if p.validating {
+		mp := cachePath(src, p.options.ModuleCache)
+		if fi, err := os.Stat(mp); err != nil || !fi.IsDir() {
+			return "", fmt.Errorf("remote module %s has not been fetched, remote modules are not fetched when validating", src)
+		}
+
+		return mp, nil
+	}
+
+	mp, err := NewGoGetter().Get(src, p.options.ModuleCache, false)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch remote module %s: %s", src, err)
+	}
+
+	return mp, nil
+}
+
 func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string, b *hclsyntax.Block, moduleName string, dependsOn []string) error {
 	rt, _ := types.DefaultTypes().CreateResource(string(types.TypeModule), name)
 
@@ -374,6 +784,11 @@ func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string,
 
 	setDisabled(ctx, rt, b.Body, false)
 
+	err = setDependsOn(ctx, rt, b.Body)
+	if err != nil {
+		return fmt.Errorf("error in file '%s': %s", file, err)
+	}
+
 	// we need to fetch the source so that we can process the child resources
 	// "source" is the attribute but we need to read this manually
 	src, diags := b.Body.Attributes["source"].Expr.Value(ctx)
@@ -390,11 +805,9 @@ func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string,
 	if err != nil || !fi.IsDir() {
 
 		// is not a directory fetch from source using go getter
-		gg := NewGoGetter()
-
-		mp, err := gg.Get(src.AsString(), p.options.ModuleCache, false)
+		mp, err := p.fetchModule(src.AsString())
 		if err != nil {
-			return fmt.Errorf("unable to fetch remote module %s: %s", src.AsString(), err)
+			return err
 		}
 
 		moduleSrc = mp
@@ -404,7 +817,7 @@ func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string,
 	moduleConfig := NewConfig()
 
 	// modules should have their own context so that variables are not globally scoped
-	subContext := buildContext(moduleSrc, p.registeredFunctions)
+	subContext := p.buildContext(moduleSrc, moduleFQDN(p.contextModules[ctx], name))
 
 	_, err = p.parseDirectory(subContext, moduleSrc, moduleConfig)
 	if err != nil {
@@ -413,6 +826,11 @@ func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string,
 
 	rt.(*types.Module).SubContext = subContext
 
+	// keep the source of the module files so that the resources can be diffed
+	for file, src := range moduleConfig.sources {
+		c.addSource(file, src)
+	}
+
 	// add the module
 	c.addResource(rt, ctx, b.Body)
 
@@ -441,6 +859,15 @@ func (p *Parser) parseModule(ctx *hcl.EvalContext, c *Config, name, file string,
 	return nil
 }
 
+// moduleFQDN returns the name of the module with the given parent
+func moduleFQDN(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
 func (p *Parser) parseResource(ctx *hcl.EvalContext, c *Config, name, file string, b *hclsyntax.Block, moduleName string, dependsOn []string, disabled bool) error {
 	rt, err := p.registeredTypes.CreateResource(b.Type, name)
 	if err != nil {
@@ -457,6 +884,11 @@ func (p *Parser) parseResource(ctx *hcl.EvalContext, c *Config, name, file strin
 
 	setDisabled(ctx, rt, b.Body, disabled)
 
+	err = setDependsOn(ctx, rt, b.Body)
+	if err != nil {
+		return fmt.Errorf("error in file '%s': %s", file, err)
+	}
+
 	err = c.addResource(rt, ctx, b.Body)
 	if err != nil {
 		return fmt.Errorf(
@@ -533,7 +965,7 @@ func setMapVariableFromPath(root map[string]cty.Value, path []string, value cty.
 	return root
 }
 
-func buildContext(filePath string, customFunctions map[string]function.Function) *hcl.EvalContext {
+func buildContext(filePath string, customFunctions map[string]function.Function, allowedFunctions []string) *hcl.EvalContext {
 	ctx := &hcl.EvalContext{
 		Functions: map[string]function.Function{},
 		Variables: map[string]cty.Value{},
@@ -543,6 +975,14 @@ func buildContext(filePath string, customFunctions map[string]function.Function)
 	ctx.Variables["resource"] = cty.ObjectVal(valMap)
 
 	ctx.Functions = getDefaultFunctions(filePath)
+	if len(allowedFunctions) > 0 {
+		filterFunctions(ctx.Functions, allowedFunctions)
+	}
+
+	// templates can call any of the functions available in the context
+	if len(allowedFunctions) == 0 || containsString(allowedFunctions, "templatefile") {
+		ctx.Functions["templatefile"] = makeTemplateFileFunction(filePath, ctx.Functions)
+	}
 
 	// add the custom functions
 	for k, v := range customFunctions {
@@ -553,7 +993,7 @@ func buildContext(filePath string, customFunctions map[string]function.Function)
 }
 
 func copyContext(path string, ctx *hcl.EvalContext) *hcl.EvalContext {
-	newCtx := buildContext(path, ctx.Functions)
+	newCtx := buildContext(path, ctx.Functions, nil)
 	newCtx.Variables = ctx.Variables
 
 	return newCtx
@@ -0,0 +1,231 @@
+package hclconfig
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// defaultImpureFunctions are the built in functions whose result depends on
+// the environment or the location the config is parsed in
+var defaultImpureFunctions = []string{
+	"env",
+	"home",
+	"file",
+	"dir",
+	"templatefile",
+	"fileexists",
+	"fileset",
+	"abspath",
+	"pathexpand",
+}
+
+// FunctionOption configures a function registered with the parser
+type FunctionOption func(*functionOptions)
+
+type functionOptions struct {
+	impure    bool
+	namespace string
+}
+
+// Impure marks a function as non-deterministic, a function is impure when it
+// can return a different result for the same arguments i.e. a function that
+// returns a random number or reads a value from the environment
+func Impure() FunctionOption {
+	return func(o *functionOptions) {
+		o.impure = true
+	}
+}
+
+// buildContext creates the context for the given path with the functions
+// registered with the parser and the config functions for the module, file
+// functions are restricted to the sandbox, env is restricted to the allowed
+// variables, and impure functions are pinned or rejected depending on the
+// parser options
+func (p *Parser) buildContext(filePath, module string) *hcl.EvalContext {
+	ctx := buildContext(filePath, p.registeredFunctions, p.options.AllowedFunctions)
+	p.contextModules[ctx] = module
+
+	for name, f := range p.allowedConfigFunctions() {
+		ctx.Functions[name] = f.Function(p.config, module)
+	}
+
+	applySandbox(ctx, filePath, p.sandboxRoots(filePath))
+
+	if _, ok := ctx.Functions["env"]; ok {
+		ctx.Functions["env"] = p.envFunction(ctx)
+	}
+
+	for name, f := range ctx.Functions {
+		if v, ok := p.options.PinnedFunctions[name]; ok {
+			ctx.Functions[name] = pinnedFunction(f, v)
+			continue
+		}
+
+		if p.options.Deterministic && p.impureFunctions[name] {
+			ctx.Functions[name] = rejectedFunction(name, f)
+		}
+	}
+
+	p.restrictModuleFunctions(ctx, module)
+
+	return ctx
+}
+
+// unpinnedImpureFunctions returns the impure functions that do not have a pinned value
+func (p *Parser) unpinnedImpureFunctions() map[string]bool {
+	impure := map[string]bool{}
+	for name, i := range p.impureFunctions {
+		if _, ok := p.options.PinnedFunctions[name]; i && !ok {
+			impure[name] = true
+		}
+	}
+
+	return impure
+}
+
+// pinnedFunction replaces f with a function that accepts the same parameters
+// and always returns v
+func pinnedFunction(f function.Function, v cty.Value) function.Function {
+	return function.New(&function.Spec{
+		Params:   f.Params(),
+		VarParam: f.VarParam(),
+		Type:     function.StaticReturnType(v.Type()),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return v, nil
+		},
+	})
+}
+
+// rejectedFunction replaces f with a function that returns an error when called
+func rejectedFunction(name string, f function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params:   f.Params(),
+		VarParam: f.VarParam(),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return cty.NilType, fmt.Errorf("function %s is not deterministic, set a value for the function in ParserOptions.PinnedFunctions", name)
+		},
+	})
+}
+
+// variableFunctions records the functions called to set the value of the
+// variables in each context, variables set from the environment using the
+// VariableEnvPrefix are recorded as calling env
+type variableFunctions map[*hcl.EvalContext]map[string][]string
+
+// set records the functions called to set the variable, replacing any
+// functions recorded when the variable was previously set
+func (v variableFunctions) set(ctx *hcl.EvalContext, name string, funcs []string) {
+	if v == nil {
+		return
+	}
+
+	if _, ok := v[ctx]; !ok {
+		v[ctx] = map[string][]string{}
+	}
+
+	v[ctx][name] = funcs
+}
+
+// setIfMissing records the functions called to set the variable when the
+// variable has not already been set
+func (v variableFunctions) setIfMissing(ctx *hcl.EvalContext, name string, funcs []string) {
+	if _, ok := v[ctx][name]; !ok {
+		v.set(ctx, name, funcs)
+	}
+}
+
+// called returns the functions called in the node and the functions called to
+// set the variables referenced by the node
+func (v variableFunctions) called(ctx *hcl.EvalContext, node hclsyntax.Node) []string {
+	funcs := []string{}
+	hclsyntax.VisitAll(node, func(n hclsyntax.Node) hcl.Diagnostics {
+		switch e := n.(type) {
+		case *hclsyntax.FunctionCallExpr:
+			funcs = append(funcs, e.Name)
+		case *hclsyntax.ScopeTraversalExpr:
+			if len(e.Traversal) < 2 || e.Traversal.RootName() != "var" {
+				return nil
+			}
+
+			if a, ok := e.Traversal[1].(hcl.TraverseAttr); ok {
+				funcs = append(funcs, v[ctx][a.Name]...)
+			}
+		}
+
+		return nil
+	})
+
+	return funcs
+}
+
+// expressionFunctions returns the functions called by the expression, see
+// variableFunctions.called
+func (v variableFunctions) expressionFunctions(ctx *hcl.EvalContext, expr hcl.Expression) []string {
+	node, ok := expr.(hclsyntax.Node)
+	if !ok {
+		return nil
+	}
+
+	return v.called(ctx, node)
+}
+
+// ImpureFunctions returns the names of the impure functions called by the given
+// resource, including the functions called to set the variables it references
+func (c *Config) ImpureFunctions(r types.Resource) []string {
+	b, ok := c.bodies[r]
+	if !ok || b == nil {
+		return nil
+	}
+
+	found := map[string]bool{}
+	for _, name := range c.variableFunctions.called(c.contexts[r], b) {
+		if c.impureFunctions[name] {
+			found[name] = true
+		}
+	}
+
+	names := []string{}
+	for n := range found {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ImpureResources returns the resources that depend on impure values, a resource
+// depends on an impure value when it calls an impure function or depends on a
+// resource or module that does
+func (c *Config) ImpureResources() ([]types.Resource, error) {
+	g, err := c.Graph()
+	if err != nil {
+		return nil, err
+	}
+
+	impure := map[types.Resource]bool{}
+	for _, r := range g.TopologicalOrder() {
+		impure[r] = len(c.ImpureFunctions(r)) > 0
+
+		for _, d := range g.Dependencies(r) {
+			if impure[d] {
+				impure[r] = true
+			}
+		}
+	}
+
+	resources := []types.Resource{}
+	for _, r := range c.Resources {
+		if impure[r] {
+			resources = append(resources, r)
+		}
+	}
+
+	return resources, nil
+}
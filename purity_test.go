@@ -0,0 +1,191 @@
+package hclconfig
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+var impureConfig = `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+network "random" {
+  subnet = "10.${random_number()}.0.0/16"
+}
+
+container "consul" {
+  command = [env("CONSUL_COMMAND")]
+
+  network {
+    name = resource.network.onprem.name
+  }
+}
+
+container "vault" {
+  network {
+    name = resource.network.random.name
+  }
+}
+`
+
+func setupImpureParser(t *testing.T, o *ParserOptions) (*Config, *Parser) {
+	c, p := setupParser(t, o)
+
+	err := p.RegisterFunction("random_number", func() (int, error) { return rand.Intn(100), nil }, Impure())
+	require.NoError(t, err)
+
+	return c, p
+}
+
+func TestImpureResourcesReturnsResourcesThatDependOnImpureFunctions(t *testing.T) {
+	c, p := setupImpureParser(t, DefaultOptions())
+
+	err := p.ParseFile(CreateTestFile(t, impureConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"env"}, c.ImpureFunctions(r))
+
+	impure, err := c.ImpureResources()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"resource.network.random",
+		"resource.container.consul",
+		"resource.container.vault",
+	}, fqdns(impure))
+}
+
+func TestImpureResourcesReturnsResourcesThatReadImpureVariables(t *testing.T) {
+	t.Setenv("HCL_VAR_from_env", "consul")
+
+	c, p := setupImpureParser(t, DefaultOptions())
+
+	err := p.ParseFile(CreateTestFile(t, `
+variable "subnet" {
+  default = "10.${random_number()}.0.0/16"
+}
+
+variable "nested" {
+  default = var.subnet
+}
+
+variable "from_env" {
+  default = "vault"
+}
+
+variable "pure" {
+  default = "10.6.0.0/16"
+}
+
+network "default" {
+  subnet = var.nested
+}
+
+network "pure" {
+  subnet = var.pure
+}
+
+container "consul" {
+  command = [var.from_env]
+}
+`), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.network.default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"random_number"}, c.ImpureFunctions(r))
+
+	r, err = c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"env"}, c.ImpureFunctions(r))
+
+	impure, err := c.ImpureResources()
+	require.NoError(t, err)
+	require.Equal(t, []string{"resource.network.default", "resource.container.consul"}, fqdns(impure))
+}
+
+func TestDeterministicParseRejectsImpureConfigFunctions(t *testing.T) {
+	o := DefaultOptions()
+	o.Deterministic = true
+
+	c, p := setupParser(t, o)
+
+	err := p.RegisterConfigFunction("random_resource", ConfigFunction{
+		Function: func(c types.ConfigReader, module string) function.Function {
+			return function.New(&function.Spec{
+				Type: function.StaticReturnType(cty.String),
+				Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+					return cty.StringVal("resource.network.onprem"), nil
+				},
+			})
+		},
+	}, Impure())
+	require.NoError(t, err)
+
+	file := CreateTestFile(t, `
+container "consul" {
+  command = [random_resource()]
+}
+`)
+
+	err = p.ParseFile(file, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "function random_resource is not deterministic")
+
+	p.options.PinnedFunctions = map[string]cty.Value{"random_resource": cty.StringVal("pinned")}
+
+	c = NewConfig()
+	err = p.ParseFile(file, c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"pinned"}, r.(*structs.Container).Command)
+}
+
+func TestDeterministicParseRejectsImpureFunctions(t *testing.T) {
+	o := DefaultOptions()
+	o.Deterministic = true
+
+	c, p := setupImpureParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, impureConfig), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not deterministic")
+}
+
+func TestDeterministicParseUsesPinnedFunctions(t *testing.T) {
+	o := DefaultOptions()
+	o.Deterministic = true
+	o.PinnedFunctions = map[string]cty.Value{
+		"random_number": cty.NumberIntVal(7),
+		"env":           cty.StringVal("consul"),
+	}
+
+	c, p := setupImpureParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, impureConfig), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.network.random")
+	require.NoError(t, err)
+	require.Equal(t, "10.7.0.0/16", r.(*structs.Network).Subnet)
+
+	r, err = c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"consul"}, r.(*structs.Container).Command)
+
+	// pinned functions are deterministic
+	impure, err := c.ImpureResources()
+	require.NoError(t, err)
+	require.Empty(t, impure)
+}
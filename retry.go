@@ -0,0 +1,136 @@
+package hclconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// RetryPolicy defines how failures are retried when processing a resource,
+// the policy is applied to Process and to the ProcessCallback
+type RetryPolicy struct {
+	// Retries is the number of times a failed attempt is retried
+	Retries int
+
+	// Backoff is the time to wait before the first retry, the time is
+	// doubled for every subsequent retry
+	Backoff time.Duration
+
+	// Timeout for each attempt, when 0 there is no timeout. The context passed
+	// to ProcessWithContext and CallbackWithContext is cancelled when the
+	// timeout expires, the attempt fails once the function has returned so
+	// functions that do not use the context run to completion
+	Timeout time.Duration
+}
+
+// retryPolicy returns the policy for a resource, the policy for the resource
+// type is overridden by the policy for the resource FQDN which is overridden
+// by the resources lifecycle block
+func (c *Config) retryPolicy(r types.Resource) (RetryPolicy, error) {
+	policy := c.retryPolicies[r.Metadata().Type]
+
+	if p, ok := c.retryPolicies[resourceFQDN(r)]; ok {
+		policy = p
+	}
+
+	lc := r.Metadata().Lifecycle
+	if lc == nil {
+		return policy, nil
+	}
+
+	if lc.Retries != nil {
+		policy.Retries = *lc.Retries
+	}
+
+	if lc.Timeout != "" {
+		d, err := time.ParseDuration(lc.Timeout)
+		if err != nil {
+			return policy, fmt.Errorf("invalid lifecycle timeout %q: %s", lc.Timeout, err)
+		}
+
+		policy.Timeout = d
+	}
+
+	if lc.Backoff != "" {
+		d, err := time.ParseDuration(lc.Backoff)
+		if err != nil {
+			return policy, fmt.Errorf("invalid lifecycle backoff %q: %s", lc.Backoff, err)
+		}
+
+		policy.Backoff = d
+	}
+
+	return policy, nil
+}
+
+// runWithPolicy calls f until it succeeds or the retries for the policy have
+// been used, every failed attempt is added to the returned diagnostics as a warning
+func (c *Config) runWithPolicy(ctx context.Context, r types.Resource, policy RetryPolicy, name string, f func(ctx context.Context) error) (tfdiags.Diagnostics, error) {
+	var diags tfdiags.Diagnostics
+
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := runWithTimeout(ctx, policy.Timeout, f)
+		if err == nil {
+			return diags, nil
+		}
+
+		if attempt > policy.Retries || ctx.Err() != nil {
+			if attempt > 1 {
+				err = fmt.Errorf("%s failed after %d attempts: %s", name, attempt, err)
+			}
+
+			return diags, err
+		}
+
+		diags = diags.Append(tfdiags.SimpleWarning(fmt.Sprintf("%s for resource %s failed on attempt %d, retrying: %s", name, resourceFQDN(r), attempt, err)))
+		c.emit(EventRetry, r, time.Time{}, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return diags, ctx.Err()
+		}
+
+		backoff *= 2
+	}
+}
+
+// Warnings returns the warnings from the last time the config was processed
+// or walked, i.e. failed attempts that were retried
+func (c *Config) Warnings() []string {
+	warnings := []string{}
+
+	for _, d := range c.warnings {
+		if d.Severity() == tfdiags.Warning {
+			warnings = append(warnings, d.Description().Summary)
+		}
+	}
+
+	return warnings
+}
+
+// runWithTimeout calls f returning an error if it does not complete before the
+// timeout. f is not abandoned when the timeout expires as it would still be
+// modifying the resource when it is retried or passed to the next resource,
+// instead the context is cancelled and the attempt fails once f returns
+func runWithTimeout(ctx context.Context, timeout time.Duration, f func(ctx context.Context) error) error {
+	if timeout == 0 {
+		return f(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := f(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+
+	return err
+}
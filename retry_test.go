@@ -0,0 +1,199 @@
+package hclconfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+var retryConfig = `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+`
+
+// failingCallback returns a callback that fails the given number of times for each resource
+func failingCallback(failures int) (ProcessCallbackWithContext, map[string]int) {
+	attempts := map[string]int{}
+	mutex := sync.Mutex{}
+
+	return func(ctx context.Context, r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		attempts[resourceFQDN(r)]++
+		if attempts[resourceFQDN(r)] <= failures {
+			return fmt.Errorf("attempt %d failed", attempts[resourceFQDN(r)])
+		}
+
+		return nil
+	}, attempts
+}
+
+func TestParseRetriesCallbackUsingTypePolicy(t *testing.T) {
+	cb, attempts := failingCallback(2)
+
+	o := DefaultOptions()
+	o.CallbackWithContext = cb
+	o.RetryPolicies = map[string]RetryPolicy{"network": {Retries: 2, Backoff: time.Millisecond}}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, retryConfig), c)
+	require.NoError(t, err)
+
+	require.Equal(t, 3, attempts["resource.network.onprem"])
+	require.Len(t, c.Warnings(), 2)
+	require.Contains(t, c.Warnings()[0], "callback for resource resource.network.onprem failed on attempt 1")
+}
+
+func TestParseFQDNPolicyOverridesTypePolicy(t *testing.T) {
+	cb, attempts := failingCallback(2)
+
+	o := DefaultOptions()
+	o.CallbackWithContext = cb
+	o.RetryPolicies = map[string]RetryPolicy{
+		"network":                 {Retries: 2},
+		"resource.network.onprem": {Retries: 1},
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, retryConfig), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "callback failed after 2 attempts: attempt 2 failed")
+	require.Equal(t, 2, attempts["resource.network.onprem"])
+}
+
+func TestParseRetriesUsingLifecycleBlock(t *testing.T) {
+	cb, attempts := failingCallback(1)
+
+	o := DefaultOptions()
+	o.CallbackWithContext = cb
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    retries = 1
+    backoff = "1ms"
+  }
+}
+`), c)
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts["resource.network.onprem"])
+
+	r, err := c.FindResource("resource.network.onprem")
+	require.NoError(t, err)
+	require.Equal(t, 1, *r.Metadata().Lifecycle.Retries)
+}
+
+func TestParseWithZeroRetriesInLifecycleBlockOverridesPolicy(t *testing.T) {
+	cb, attempts := failingCallback(1)
+
+	o := DefaultOptions()
+	o.CallbackWithContext = cb
+	o.RetryPolicies = map[string]RetryPolicy{"network": {Retries: 2}}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    retries = 0
+  }
+}
+`), c)
+	require.Error(t, err)
+	require.Equal(t, 1, attempts["resource.network.onprem"])
+}
+
+func TestParseWaitsForTimedOutCallbackBeforeRetrying(t *testing.T) {
+	running := 0
+	overlapped := false
+	attempts := 0
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		running++
+		attempts++
+		overlapped = overlapped || running > 1
+		mutex.Unlock()
+
+		// ignores the context so runs past the timeout
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		return nil
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    timeout = "5ms"
+    retries = 1
+  }
+}
+`), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 5ms")
+	require.Equal(t, 2, attempts)
+	require.False(t, overlapped)
+}
+
+func TestParseTimesOutCallbackUsingLifecycleBlock(t *testing.T) {
+	o := DefaultOptions()
+	o.CallbackWithContext = func(ctx context.Context, r types.Resource) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    timeout = "10ms"
+  }
+}
+`), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 10ms")
+}
+
+func TestParseWithInvalidLifecycleReturnsError(t *testing.T) {
+	c, p := setupParser(t)
+
+	err := p.ParseFile(CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    timeout = "ten seconds"
+  }
+}
+`), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid lifecycle timeout")
+}
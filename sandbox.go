@@ -0,0 +1,131 @@
+package hclconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// sandboxedFunctions are the built in functions that read files, the first
+// argument of each function is the path that is read
+var sandboxedFunctions = []string{
+	"file",
+	"templatefile",
+	"fileexists",
+	"fileset",
+}
+
+// sandboxRoots returns the directories the file functions in the config at
+// filePath can access, remote modules can only access the files in their
+// own directory in the module cache even when FileSandbox is not set
+func (p *Parser) sandboxRoots(filePath string) []string {
+	if p.options.ModuleCache != "" {
+		// symlinks are not resolved as go-getter links modules fetched from the
+		// local filesystem into the cache
+		cache := ensureAbsolute(p.options.ModuleCache, ".")
+		path := ensureAbsolute(filePath, ".")
+
+		rel, err := filepath.Rel(cache, path)
+		if err == nil && rel != "." && isWithin(cache, path) {
+			// modules are downloaded to a folder in the root of the cache
+			module := strings.Split(filepath.ToSlash(rel), "/")[0]
+
+			return []string{filepath.Join(cache, module)}
+		}
+	}
+
+	if len(p.options.FileSandbox) == 0 {
+		return nil
+	}
+
+	roots := []string{}
+	for _, r := range p.options.FileSandbox {
+		roots = append(roots, ensureAbsolute(r, "."))
+	}
+
+	return roots
+}
+
+// applySandbox replaces the file functions in the context with functions that
+// return an error when the path is not within one of the roots
+func applySandbox(ctx *hcl.EvalContext, filePath string, roots []string) {
+	if len(roots) == 0 {
+		return
+	}
+
+	resolved := []string{}
+	for _, r := range roots {
+		resolved = append(resolved, resolveSymlinks(r))
+	}
+
+	for _, name := range sandboxedFunctions {
+		if f, ok := ctx.Functions[name]; ok {
+			ctx.Functions[name] = sandboxedFunction(f, filePath, resolved)
+		}
+	}
+}
+
+// sandboxedFunction wraps f, which must take a path as the first argument,
+// and checks the path is within the roots before calling f
+func sandboxedFunction(f function.Function, filePath string, roots []string) function.Function {
+	return function.New(&function.Spec{
+		Params:   f.Params(),
+		VarParam: f.VarParam(),
+		Type:     f.ReturnTypeForValues,
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			err := checkSandbox(ensureAbsolute(args[0].AsString(), filePath), roots)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			return f.Call(args)
+		},
+	})
+}
+
+// checkSandbox returns an error when the path, after resolving any symlinks,
+// is not within one of the roots
+func checkSandbox(path string, roots []string) error {
+	resolved := resolveSymlinks(path)
+
+	for _, r := range roots {
+		if isWithin(r, resolved) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("path %s is outside of the sandbox, files can only be read from: %s", path, strings.Join(roots, ", "))
+}
+
+// isWithin returns true when path is dir or is contained by dir
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveSymlinks returns the path with all symlinks resolved, when the path
+// does not exist the symlinks in the closest existing parent are resolved
+func resolveSymlinks(path string) string {
+	path = filepath.Clean(path)
+
+	r, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return r
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path || !os.IsNotExist(err) {
+		return path
+	}
+
+	return filepath.Join(resolveSymlinks(parent), filepath.Base(path))
+}
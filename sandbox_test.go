@@ -0,0 +1,164 @@
+package hclconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSandbox(t *testing.T, config string) (string, *ParserOptions) {
+	dir := createTempDirectory(t)
+	t.Cleanup(func() { removeTestFiles(t, dir) })
+
+	writeTestFile(t, dir, "secret.txt", "secret")
+	writeTestFile(t, dir, "config/files/allowed.txt", "allowed")
+	writeTestFile(t, dir, "config/main.hcl", config)
+
+	err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "config", "files", "link.txt"))
+	require.NoError(t, err)
+
+	o := DefaultOptions()
+	o.ModuleCache = filepath.Join(dir, "cache")
+	o.FileSandbox = []string{filepath.Join(dir, "config")}
+
+	return dir, o
+}
+
+func TestParseWithSandboxReadsFilesInSandbox(t *testing.T) {
+	dir, o := setupSandbox(t, `
+container "consul" {
+  command = [file("./files/allowed.txt"), fileexists("./files/missing.txt") ? "true" : "false"]
+}
+`)
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"allowed", "false"}, r.(*structs.Container).Command)
+}
+
+func TestParseWithSandboxReturnsErrorForRelativePathOutsideSandbox(t *testing.T) {
+	dir, o := setupSandbox(t, `
+container "consul" {
+  command = [file("./files/../../secret.txt")]
+}
+`)
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is outside of the sandbox")
+}
+
+func TestParseWithSandboxReturnsErrorForAbsolutePathOutsideSandbox(t *testing.T) {
+	dir, o := setupSandbox(t, `
+container "consul" {
+  command = [templatefile("/etc/hosts", {})]
+}
+`)
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is outside of the sandbox")
+}
+
+func TestParseWithSandboxReturnsErrorForSymlinkOutsideSandbox(t *testing.T) {
+	dir, o := setupSandbox(t, `
+container "consul" {
+  command = [file("./files/link.txt")]
+}
+`)
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is outside of the sandbox")
+}
+
+func TestParseWithoutSandboxReadsFilesOutsideConfig(t *testing.T) {
+	dir, o := setupSandbox(t, `
+container "consul" {
+  command = [file("./files/link.txt")]
+}
+`)
+
+	o.FileSandbox = nil
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.NoError(t, err)
+
+	r, err := c.FindResource("resource.container.consul")
+	require.NoError(t, err)
+	require.Equal(t, []string{"secret"}, r.(*structs.Container).Command)
+}
+
+func TestParseWithSandboxConfinesRemoteModulesToCache(t *testing.T) {
+	dir, o := setupSandbox(t, "")
+
+	writeTestFile(t, dir, "remote/data.txt", "data")
+	writeTestFile(t, dir, "remote/main.hcl", `
+container "allowed" {
+  command = [file("./data.txt")]
+}
+
+container "secret" {
+  command = [file("../secret.txt")]
+}
+`)
+
+	// the module source is not a local folder so it is fetched into the cache
+	writeTestFile(t, dir, "config/main.hcl", `
+module "remote" {
+  source = "`+filepath.ToSlash(filepath.Join(dir, "remote"))+`"
+}
+`)
+
+	// allow the root config to read the remote module to ensure the module is
+	// restricted by the cache and not the sandbox
+	o.FileSandbox = append(o.FileSandbox, dir)
+
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is outside of the sandbox")
+
+	r, err := c.FindResource("module.remote.resource.container.allowed")
+	require.NoError(t, err)
+	require.Equal(t, []string{"data"}, r.(*structs.Container).Command)
+}
+
+func TestParseWithoutSandboxConfinesRemoteModulesToCache(t *testing.T) {
+	dir, o := setupSandbox(t, "")
+
+	writeTestFile(t, dir, "remote/main.hcl", `
+container "secret" {
+  command = [file("../secret.txt")]
+}
+`)
+
+	writeTestFile(t, dir, "config/main.hcl", `
+module "remote" {
+  source = "`+filepath.ToSlash(filepath.Join(dir, "remote"))+`"
+}
+`)
+
+	o.FileSandbox = nil
+	c, p := setupParser(t, o)
+
+	err := p.ParseFile(filepath.Join(dir, "config", "main.hcl"), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is outside of the sandbox")
+}
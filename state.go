@@ -0,0 +1,405 @@
+package hclconfig
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/shipyard-run/hclconfig/types"
+)
+
+// stateVersion is the version of the state file format
+const stateVersion = 1
+
+// ResourceState is the recorded state of a resource after it has been
+// successfully processed
+type ResourceState struct {
+	// Type of the resource
+	Type string `json:"type"`
+
+	// Hash of the resources configuration after it has been decoded,
+	// if the hash is unchanged between runs the resource is unchanged
+	Hash string `json:"hash"`
+
+	// Attributes of the resource keyed by attribute name, these are the
+	// values after the ProcessCallback has been called
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// State contains the state for every processed resource, keyed by the
+// resources FQDN
+type State struct {
+	Version   int                       `json:"version"`
+	Resources map[string]*ResourceState `json:"resources"`
+}
+
+// NewState creates a new empty state
+func NewState() *State {
+	return &State{Version: stateVersion, Resources: map[string]*ResourceState{}}
+}
+
+// Resource returns the state for the resource with the given FQDN or nil
+// if the resource has no state
+func (s *State) Resource(fqdn string) *ResourceState {
+	return s.Resources[fqdn]
+}
+
+// StateBackend stores and retrieves state, a backend must be locked before
+// the state is loaded and is unlocked once the state has been saved
+type StateBackend interface {
+	// Lock the state, an error is returned if the state is already locked
+	Lock() error
+	// Unlock the state
+	Unlock() error
+	// Load the state, when no state exists an empty state is returned
+	Load() (*State, error)
+	// Save the state
+	Save(s *State) error
+}
+
+// StateLockedError is returned when a StateBackend is already locked
+type StateLockedError struct {
+	Path string
+
+	// PID of the process holding the lock, 0 when unknown
+	PID int
+}
+
+func (e StateLockedError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("state is locked by process %d, if the process is not running remove the lock file: %s", e.PID, e.Path)
+	}
+
+	return fmt.Sprintf("state is locked by another process, if no other process is running remove the lock file: %s", e.Path)
+}
+
+// FileStateBackend stores state as JSON in a local file, locking is
+// implemented using a lock file alongside the state file containing the
+// PID of the process that holds the lock
+type FileStateBackend struct {
+	path string
+}
+
+// NewFileStateBackend creates a StateBackend that stores state in the given file
+func NewFileStateBackend(path string) *FileStateBackend {
+	return &FileStateBackend{path: path}
+}
+
+func (f *FileStateBackend) lockPath() string {
+	return f.path + ".lock"
+}
+
+// Lock creates the lock file, if the lock file exists and the process that
+// created it is still running StateLockedError is returned. A lock file left
+// by a process that is no longer running is stale and is replaced.
+func (f *FileStateBackend) Lock() error {
+	err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("unable to create state directory: %s", err)
+	}
+
+	err = writeExclusive(f.lockPath())
+	if !os.IsExist(err) {
+		return err
+	}
+
+	pid, stale := f.staleLock()
+	if !stale {
+		return StateLockedError{Path: f.lockPath(), PID: pid}
+	}
+
+	err = f.replaceStaleLock(pid)
+	if err != nil {
+		return err
+	}
+
+	// check the lock now belongs to this process
+	if pid, _ := readPID(f.lockPath()); pid != os.Getpid() {
+		return StateLockedError{Path: f.lockPath(), PID: pid}
+	}
+
+	return nil
+}
+
+// replaceStaleLock atomically replaces the lock file created by the process
+// with the given PID. Only one process can replace a stale lock at a time, the
+// process holds a takeover lock while it checks the lock file is still stale
+// and renames a new lock file over it.
+func (f *FileStateBackend) replaceStaleLock(pid int) error {
+	takeover := f.lockPath() + ".takeover"
+
+	err := writeExclusive(takeover)
+	if os.IsExist(err) {
+		// another process is replacing the lock
+		owner, _ := readPID(takeover)
+		return StateLockedError{Path: takeover, PID: owner}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(takeover)
+
+	// the lock may have been replaced since it was read
+	if current, _ := readPID(f.lockPath()); current != pid {
+		return StateLockedError{Path: f.lockPath(), PID: current}
+	}
+
+	tmp, err := writePIDFile(f.lockPath())
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, f.lockPath())
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to replace stale lock file: %s", err)
+	}
+
+	return nil
+}
+
+// writeExclusive creates the file at path containing the current PID, the
+// file is written to a temporary file and linked into place so that it is
+// never seen without the PID. Linking fails when the file exists, in which
+// case the error satisfies os.IsExist.
+func writeExclusive(path string) error {
+	tmp, err := writePIDFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp)
+
+	err = os.Link(tmp, path)
+	if err != nil {
+		if os.IsExist(err) {
+			return err
+		}
+
+		return fmt.Errorf("unable to create lock file: %s", err)
+	}
+
+	return nil
+}
+
+// writePIDFile writes the current PID to a temporary file alongside path and
+// returns the name of the temporary file
+func writePIDFile(path string) (string, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return "", fmt.Errorf("unable to create lock file: %s", err)
+	}
+
+	fmt.Fprintf(tmp, "%d", os.Getpid())
+
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("unable to create lock file: %s", err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// staleLock returns the PID in the lock file and true when the process is no
+// longer running, a lock file that can not be read is not stale
+func (f *FileStateBackend) staleLock() (int, bool) {
+	pid, err := readPID(f.lockPath())
+	if err != nil {
+		return 0, false
+	}
+
+	return pid, !processRunning(pid)
+}
+
+// readPID returns the PID in the given lock file
+func readPID(path string) (int, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(d)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("lock file %s does not contain a PID", path)
+	}
+
+	return pid, nil
+}
+
+// processRunning returns true when a process with the given PID exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = p.Signal(syscall.Signal(0))
+
+	return !errors.Is(err, os.ErrProcessDone)
+}
+
+// Unlock removes the lock file
+func (f *FileStateBackend) Unlock() error {
+	err := os.Remove(f.lockPath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove lock file: %s", err)
+	}
+
+	return nil
+}
+
+// Load reads the state from the file, if the file does not exist an
+// empty state is returned
+func (f *FileStateBackend) Load() (*State, error) {
+	d, err := ioutil.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewState(), nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file: %s", err)
+	}
+
+	s := NewState()
+	err = json.Unmarshal(d, s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode state file %s: %s", f.path, err)
+	}
+
+	if s.Resources == nil {
+		s.Resources = map[string]*ResourceState{}
+	}
+
+	return s, nil
+}
+
+// Save writes the state to the file, the state is written to a temporary
+// file first so that a failed write does not corrupt existing state
+func (f *FileStateBackend) Save(s *State) error {
+	d, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode state: %s", err)
+	}
+
+	tmp := f.path + ".tmp"
+
+	err = ioutil.WriteFile(tmp, d, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write state file: %s", err)
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+// resourceStates tracks the hashes of resources as they are processed
+// and compares them to the previous state
+type resourceStates struct {
+	previous  *State
+	hashes    map[types.Resource]string
+	unchanged map[types.Resource]bool
+	m         sync.Mutex
+
+	// skipped is true when the callback is not called for unchanged resources
+	skipped bool
+}
+
+func newResourceStates(previous *State, skipped bool) *resourceStates {
+	return &resourceStates{
+		previous:  previous,
+		skipped:   skipped,
+		hashes:    map[types.Resource]string{},
+		unchanged: map[types.Resource]bool{},
+	}
+}
+
+// record sets the hash for the resource and returns true if the resource
+// is unchanged since the previous state
+func (s *resourceStates) record(r types.Resource, hash string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.hashes[r] = hash
+
+	prev := s.previous.Resource(resourceFQDN(r))
+	unchanged := prev != nil && prev.Type == r.Metadata().Type && prev.Hash == hash
+
+	s.unchanged[r] = unchanged
+
+	return unchanged
+}
+
+func (s *resourceStates) isUnchanged(r types.Resource) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.unchanged[r]
+}
+
+// hashResource returns a hash of the resources decoded configuration,
+// the caller must hold the lock for the resources context
+func (c *Config) hashResource(r types.Resource) (string, error) {
+	d, err := c.marshalResource(r, true)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(d)), nil
+}
+
+// Unchanged returns true when the state has been enabled with ParserOptions.State
+// and the configuration for the resource has not changed since the state was
+// last saved. Resources are only compared once they have been processed, this
+// method can be used inside a ProcessCallback.
+func (c *Config) Unchanged(r types.Resource) bool {
+	if c.states == nil {
+		return false
+	}
+
+	return c.states.isUnchanged(r)
+}
+
+// newState creates the state for all resources that have been processed,
+// the attributes of resources that were skipped as unchanged or were not
+// targeted are taken from the previous state
+func (c *Config) newState() (*State, error) {
+	s := NewState()
+
+	for _, r := range c.Resources {
+		fqdn := resourceFQDN(r)
+
+		hash, ok := c.states.hashes[r]
+		if !ok {
+			// keep the state for resources that were not targeted
+			if prev := c.states.previous.Resource(fqdn); prev != nil && !c.isTargeted(r) {
+				s.Resources[fqdn] = prev
+			}
+
+			continue
+		}
+
+		if c.states.unchanged[r] && c.states.skipped {
+			s.Resources[fqdn] = c.states.previous.Resource(fqdn)
+			continue
+		}
+
+		attrs, err := c.attributeValues(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create state for resource %s: %s", fqdn, err)
+		}
+
+		s.Resources[fqdn] = &ResourceState{Type: r.Metadata().Type, Hash: hash, Attributes: attrs}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,218 @@
+package hclconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+var stateConfig = `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "consul" {
+  command = ["consul"]
+
+  volume {
+    source      = resource.network.onprem.subnet
+    destination = "/data"
+  }
+}
+
+container "vault" {
+  command = ["vault"]
+}
+`
+
+func setupStateParser(t *testing.T, statePath string) (*Parser, *[]string) {
+	called := []string{}
+	mutex := sync.Mutex{}
+
+	o := DefaultOptions()
+	o.State = NewFileStateBackend(statePath)
+	o.SkipUnchanged = true
+	o.Callback = func(r types.Resource) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		called = append(called, resourceFQDN(r))
+		return nil
+	}
+
+	_, p := setupParser(t, o)
+
+	return p, &called
+}
+
+func TestFileStateBackendLockReturnsErrorWhenLocked(t *testing.T) {
+	b := NewFileStateBackend(filepath.Join(t.TempDir(), "state.json"))
+
+	err := b.Lock()
+	require.NoError(t, err)
+
+	err = b.Lock()
+	require.ErrorAs(t, err, &StateLockedError{})
+
+	err = b.Unlock()
+	require.NoError(t, err)
+
+	err = b.Lock()
+	require.NoError(t, err)
+}
+
+func TestFileStateBackendLockReplacesStaleLock(t *testing.T) {
+	b := NewFileStateBackend(filepath.Join(t.TempDir(), "state.json"))
+
+	err := ioutil.WriteFile(b.lockPath(), []byte(strconv.Itoa(exitedPID(t))), 0644)
+	require.NoError(t, err)
+
+	err = b.Lock()
+	require.NoError(t, err)
+
+	d, err := ioutil.ReadFile(b.lockPath())
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(os.Getpid()), string(d))
+}
+
+// exitedPID returns the PID of a process that has exited
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	require.NoError(t, err)
+
+	return cmd.Process.Pid
+}
+
+func TestFileStateBackendConcurrentLockReplacesStaleLockOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	err := ioutil.WriteFile(path+".lock", []byte(strconv.Itoa(exitedPID(t))), 0644)
+	require.NoError(t, err)
+
+	errs := make([]error, 20)
+	wg := sync.WaitGroup{}
+
+	for i := range errs {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = NewFileStateBackend(path).Lock()
+		}(i)
+	}
+
+	wg.Wait()
+
+	locked := 0
+	for _, err := range errs {
+		if err == nil {
+			locked++
+			continue
+		}
+
+		require.ErrorAs(t, err, &StateLockedError{})
+	}
+
+	require.Equal(t, 1, locked)
+	// only the lock file remains
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	d, err := ioutil.ReadFile(path + ".lock")
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(os.Getpid()), string(d))
+}
+
+func TestFileStateBackendLockReturnsErrorWhenLockedByRunningProcess(t *testing.T) {
+	b := NewFileStateBackend(filepath.Join(t.TempDir(), "state.json"))
+
+	err := ioutil.WriteFile(b.lockPath(), []byte(strconv.Itoa(os.Getppid())), 0644)
+	require.NoError(t, err)
+
+	err = b.Lock()
+
+	le := StateLockedError{}
+	require.ErrorAs(t, err, &le)
+	require.Equal(t, os.Getppid(), le.PID)
+}
+
+func TestFileStateBackendLoadReturnsEmptyStateWhenNoFile(t *testing.T) {
+	b := NewFileStateBackend(filepath.Join(t.TempDir(), "state.json"))
+
+	s, err := b.Load()
+	require.NoError(t, err)
+	require.Empty(t, s.Resources)
+}
+
+func TestParseWithStateSavesResources(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	p, _ := setupStateParser(t, statePath)
+
+	err := p.ParseFile(CreateTestFile(t, stateConfig), NewConfig())
+	require.NoError(t, err)
+
+	s, err := NewFileStateBackend(statePath).Load()
+	require.NoError(t, err)
+	require.Len(t, s.Resources, 3)
+
+	net := s.Resource("resource.network.onprem")
+	require.NotNil(t, net)
+	require.Equal(t, "network", net.Type)
+	require.NotEmpty(t, net.Hash)
+	require.Equal(t, "10.6.0.0/16", net.Attributes["subnet"])
+
+	// the lock should be removed
+	require.NoFileExists(t, statePath+".lock")
+}
+
+func TestParseWithStateSkipsUnchangedResources(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	file := CreateTestFile(t, stateConfig)
+
+	p, called := setupStateParser(t, statePath)
+	err := p.ParseFile(file, NewConfig())
+	require.NoError(t, err)
+	require.Len(t, *called, 3)
+
+	// nothing has changed
+	p, called = setupStateParser(t, statePath)
+	c := NewConfig()
+	err = p.ParseFile(file, c)
+	require.NoError(t, err)
+	require.Len(t, *called, 0)
+
+	r, err := c.FindResource("resource.container.vault")
+	require.NoError(t, err)
+	require.True(t, c.Unchanged(r))
+
+	// change the network, consul has a link to the network so should also change
+	err = os.WriteFile(file, []byte(strings.Replace(stateConfig, "10.6.0.0/16", "10.7.0.0/16", 1)), 0644)
+	require.NoError(t, err)
+
+	p, called = setupStateParser(t, statePath)
+	err = p.ParseFile(file, NewConfig())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"resource.network.onprem", "resource.container.consul"}, *called)
+}
+
+func TestParseWithLockedStateReturnsError(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	b := NewFileStateBackend(statePath)
+	err := b.Lock()
+	require.NoError(t, err)
+
+	p, _ := setupStateParser(t, statePath)
+	err = p.ParseFile(CreateTestFile(t, stateConfig), NewConfig())
+	require.ErrorAs(t, err, &StateLockedError{})
+}
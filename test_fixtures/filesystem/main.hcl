@@ -0,0 +1,15 @@
+container "base" {
+  command = ["consul", "agent", "-config-file", abspath("./templates/config.tpl")]
+
+  env = {
+    "template"   = templatefile("./templates/config.tpl", { name = "root", ports = [8500, 8600] })
+    "exists"     = fileexists("./templates/config.tpl")
+    "not_exists" = fileexists("./templates/missing.tpl")
+    "fileset"    = join(",", fileset("./", "templates/*.tpl"))
+    "home"       = pathexpand("~/.shipyard")
+  }
+}
+
+module "sub" {
+  source = "./module"
+}
@@ -0,0 +1,8 @@
+container "sub" {
+  command = ["consul"]
+
+  env = {
+    "template" = templatefile("./templates/config.tpl", { name = "module" })
+    "exists"   = fileexists("./templates/config.tpl")
+  }
+}
@@ -0,0 +1,4 @@
+name = "${upper(name)}"
+%{ for p in ports ~}
+port = ${p}
+%{ endfor ~}
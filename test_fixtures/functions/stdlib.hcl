@@ -0,0 +1,24 @@
+container "base" {
+  command = split(" ", upper("consul agent -dev"))
+
+  env = {
+    "format"     = format("%s-%d", "consul", 1)
+    "join"       = join(",", concat(["a", "b"], ["c"]))
+    "replace"    = replace(trimspace("  a-b  "), "-", "_")
+    "regex"      = regex("[0-9]+", "consul123")
+    "merge"      = jsonencode(merge({ a = 1 }, { b = 2 }))
+    "keys"       = join(",", keys({ a = 1, b = 2 }))
+    "lookup"     = lookup({ a = "1" }, "b", "default")
+    "flatten"    = len(flatten([["a"], ["b", "c"]]))
+    "distinct"   = len(distinct(["a", "a", "b"]))
+    "contains"   = contains(["a", "b"], "b")
+    "min"        = min(3, 1, 2)
+    "ceil"       = ceil(1.2)
+    "jsondecode" = jsondecode("{\"a\": \"json\"}").a
+    "yamlencode" = yamlencode({ a = "yaml" })
+    "yamldecode" = yamldecode("a: yaml").a
+    "base64"     = base64decode(base64encode("consul"))
+    "sha256"     = sha256("consul")
+    "md5"        = md5("consul")
+  }
+}
@@ -0,0 +1,16 @@
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "consul" {
+  network {
+    name       = resource.network.onprem.name
+    ip_address = cidrhost(resource.network.onprem.subnet, 200)
+  }
+
+  env = {
+    "subnet"   = cidrsubnet(resource.network.onprem.subnet, 8, 2)
+    "netmask"  = cidrnetmask(resource.network.onprem.subnet)
+    "contains" = cidrcontains(resource.network.onprem.subnet, "10.6.0.200")
+  }
+}
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -157,3 +158,21 @@ func removeTestFiles(t *testing.T, dir string) {
 		t.Fatalf("Unable to remove temporary files %s", err)
 	}
 }
+
+// writeTestFile writes a file with the given name to dir, any parent
+// directories in the name are created
+func writeTestFile(t *testing.T, dir, name, contents string) string {
+	fp := filepath.Join(dir, name)
+
+	err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		t.Fatalf("Unable to create directory: %s", err)
+	}
+
+	err = ioutil.WriteFile(fp, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("Error writing test file: %s", err)
+	}
+
+	return fp
+}
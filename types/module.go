@@ -18,5 +18,5 @@ type Module struct {
 
 	// SubContext is used to store the variables as a context that can be
 	// passed to child resources
-	SubContext *hcl.EvalContext
+	SubContext *hcl.EvalContext `json:"-"`
 }
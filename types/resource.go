@@ -1,5 +1,11 @@
 package types
 
+import (
+	"context"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
 // Processable defines an optional interface that allows a resource to define a callback
 // that is executed when the resources is processed by the DAG.
 type Processable interface {
@@ -7,6 +13,91 @@ type Processable interface {
 	Process() error
 }
 
+// ProcessableWithContext defines an optional interface that allows a resource to define a
+// callback that is executed when the resource is processed by the DAG. The context is
+// cancelled when parsing is cancelled. If a resource implements both ProcessableWithContext
+// and Processable only ProcessWithContext is called.
+type ProcessableWithContext interface {
+	// ProcessWithContext is called by the parser when the DAG is resolved
+	ProcessWithContext(ctx context.Context) error
+}
+
+// Defaulter defines an optional interface that allows a resource to set default values,
+// SetDefaults is called after the resource has been decoded and before it is validated.
+type Defaulter interface {
+	// SetDefaults is called by the parser after the resource has been decoded
+	SetDefaults() error
+}
+
+// Validator defines an optional interface that allows a resource to validate its fields,
+// Validate is called after defaults have been set and before the resource is processed.
+// Diagnostics with an Attribute are reported at the location of the attribute, other
+// diagnostics that do not have a Subject are reported at the location of the resource.
+type Validator interface {
+	// Validate returns error diagnostics for invalid fields, warnings are returned
+	// as warnings from Config.Warnings
+	Validate() AttributeDiagnostics
+}
+
+// AttributeDiagnostic is a diagnostic for an attribute of a resource
+type AttributeDiagnostic struct {
+	// Attribute is the hcl name of the attribute, attributes in nested blocks are
+	// separated by a "." i.e. resources.cpu. When empty the diagnostic is for the
+	// resource
+	Attribute string
+
+	*hcl.Diagnostic
+}
+
+// AttributeDiagnostics is a list of diagnostics returned by a Validator
+type AttributeDiagnostics []AttributeDiagnostic
+
+// HasErrors returns true if any of the diagnostics are errors
+func (a AttributeDiagnostics) HasErrors() bool {
+	for _, d := range a {
+		if d.Severity == hcl.DiagError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConfigReader provides read access to the resources in a config
+type ConfigReader interface {
+	// FindResource returns the resource for the given FQDN i.e. resource.container.consul
+	FindResource(path string) (Resource, error)
+	// FindRelativeResource returns the resource for the given FQDN relative to the parent module
+	FindRelativeResource(path string, parentModule string) (Resource, error)
+	// FindResourcesByType returns all the resources of the given type
+	FindResourcesByType(t string) ([]Resource, error)
+	// FindModuleResources returns the resources in the given module i.e. module.consul
+	FindModuleResources(module string, includeSubModules bool) ([]Resource, error)
+	// ResourceCount returns the number of resources in the config
+	ResourceCount() int
+}
+
+// Finalizer defines an optional interface that allows a resource to define a callback that
+// is executed once every resource in the config has been processed.
+type Finalizer interface {
+	// Finalize is called by the parser after the DAG has been walked
+	Finalize(c ConfigReader) error
+}
+
+// Destroyable defines an optional interface that allows a resource to define a callback
+// that is executed when the resource is destroyed by a reverse walk of the DAG.
+type Destroyable interface {
+	// Destroy is called by Config.Walk when walking the DAG in reverse
+	Destroy() error
+}
+
+// DestroyableWithContext is the context aware version of Destroyable, if a resource
+// implements both DestroyableWithContext and Destroyable only DestroyWithContext is called.
+type DestroyableWithContext interface {
+	// DestroyWithContext is called by Config.WalkWithContext when walking the DAG in reverse
+	DestroyWithContext(ctx context.Context) error
+}
+
 // Resource is an interface that all
 type Resource interface {
 	// return the resource Metadata
@@ -33,6 +124,25 @@ type ResourceMetadata struct {
 
 	// Enabled determines if a resource is enabled and should be processed
 	Disabled bool `hcl:"disabled,optional" json:"disabled,omitempty"`
+
+	// Lifecycle defines the timeout and retries used when processing the resource
+	Lifecycle *Lifecycle `hcl:"lifecycle,block" json:"lifecycle,omitempty"`
+}
+
+// Lifecycle is a meta block that can be added to any resource to control how
+// the resource is processed, values override the retry policies set in the
+// parser options
+type Lifecycle struct {
+	// Timeout for each attempt to process the resource i.e. 30s
+	Timeout string `hcl:"timeout,optional" json:"timeout,omitempty"`
+
+	// Retries is the number of times processing is retried after a failure, nil
+	// when not set so that retries = 0 can override a retry policy
+	Retries *int `hcl:"retries,optional" json:"retries,omitempty"`
+
+	// Backoff is the time to wait before the first retry i.e. 1s, the time
+	// is doubled for every subsequent retry
+	Backoff string `hcl:"backoff,optional" json:"backoff,omitempty"`
 }
 
 func (r *ResourceMetadata) Metadata() *ResourceMetadata {
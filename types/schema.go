@@ -0,0 +1,345 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AttributeSchema describes a single attribute of a resource or block
+type AttributeSchema struct {
+	// Name of the attribute as defined in the hcl tag
+	Name string `json:"name"`
+
+	// Type is the HCL representation of the Go type i.e. string, number, list(string)
+	Type string `json:"type"`
+
+	// Required is true when the hcl tag is not marked optional
+	Required bool `json:"required"`
+
+	// Meta is true when the attribute is one of the built-in meta-arguments
+	// like depends_on or disabled that every resource accepts
+	Meta bool `json:"meta,omitempty"`
+
+	// Description is taken from the `description` struct tag
+	Description string `json:"description,omitempty"`
+
+	// Default is the value of the `default` struct tag, this is informational
+	// only, defaults should be set by the resource
+	Default string `json:"default,omitempty"`
+
+	goType reflect.Type
+}
+
+// BlockSchema describes a resource or a nested block and the attributes
+// and blocks it accepts
+type BlockSchema struct {
+	// Name of the resource type or the nested block
+	Name string `json:"name"`
+
+	// Description is taken from the `description` struct tag
+	Description string `json:"description,omitempty"`
+
+	// Required is true when a nested block must be specified at least once
+	Required bool `json:"required"`
+
+	// Repeated is true when a nested block can be specified multiple times
+	Repeated bool `json:"repeated"`
+
+	// Meta is true when the block is one of the built-in meta-arguments
+	// like lifecycle that every resource accepts
+	Meta bool `json:"meta,omitempty"`
+
+	Attributes []*AttributeSchema `json:"attributes,omitempty"`
+	Blocks     []*BlockSchema     `json:"blocks,omitempty"`
+}
+
+// Attribute returns the attribute with the given name or nil
+func (b *BlockSchema) Attribute(name string) *AttributeSchema {
+	for _, a := range b.Attributes {
+		if a.Name == name {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// Block returns the nested block with the given name or nil
+func (b *BlockSchema) Block(name string) *BlockSchema {
+	for _, nb := range b.Blocks {
+		if nb.Name == name {
+			return nb
+		}
+	}
+
+	return nil
+}
+
+// Schema returns the schema for the registered type with the given name
+func (r RegisteredTypes) Schema(resourceType string) (*BlockSchema, error) {
+	t, ok := r[resourceType]
+	if !ok {
+		return nil, TypeNotRegisteredError
+	}
+
+	s := schemaFromType(reflect.TypeOf(t), false)
+	s.Name = resourceType
+	s.Required = true
+
+	return s, nil
+}
+
+// Schemas returns the schema for every registered type, ordered by type name
+func (r RegisteredTypes) Schemas() []*BlockSchema {
+	names := []string{}
+	for k := range r {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	schemas := []*BlockSchema{}
+	for _, n := range names {
+		s, _ := r.Schema(n)
+		schemas = append(schemas, s)
+	}
+
+	return schemas
+}
+
+// JSONSchema returns a JSON Schema (draft-07) document describing the
+// registered types as they would be written using the HCL JSON syntax, i.e.
+// {"container": {"consul": {"image": "consul"}}}
+func (r RegisteredTypes) JSONSchema() ([]byte, error) {
+	definitions := map[string]interface{}{
+		"expression": map[string]interface{}{
+			"description": "an HCL template expression i.e. ${resource.network.onprem.name}",
+			"type":        "string",
+			"pattern":     `^.*\$\{.*\}.*$`,
+		},
+	}
+
+	properties := map[string]interface{}{}
+
+	for _, s := range r.Schemas() {
+		definitions[s.Name] = jsonSchemaForBlock(s)
+		properties[s.Name] = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"$ref": "#/definitions/" + s.Name},
+		}
+	}
+
+	doc := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+		"definitions":          definitions,
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func schemaFromType(t reflect.Type, meta bool) *BlockSchema {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	s := &BlockSchema{}
+
+	if t.Kind() != reflect.Struct {
+		return s
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, kind, ok := ParseHCLTag(f)
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "remain":
+			// embedded structs like ResourceMetadata contain the meta-arguments
+			// add their fields to the parent
+			sub := schemaFromType(f.Type, true)
+			for _, a := range sub.Attributes {
+				if s.Attribute(a.Name) == nil {
+					s.Attributes = append(s.Attributes, a)
+				}
+			}
+
+			for _, b := range sub.Blocks {
+				if s.Block(b.Name) == nil {
+					s.Blocks = append(s.Blocks, b)
+				}
+			}
+		case "block":
+			b := schemaFromType(f.Type, meta)
+			b.Name = name
+			b.Description = f.Tag.Get("description")
+			b.Required = f.Type.Kind() == reflect.Struct
+			b.Repeated = f.Type.Kind() == reflect.Slice
+			b.Meta = meta
+
+			s.Blocks = append(s.Blocks, b)
+		case "attr", "optional":
+			// resources can redefine meta-arguments, i.e. depends_on
+			// the first definition wins
+			if s.Attribute(name) != nil {
+				continue
+			}
+
+			s.Attributes = append(s.Attributes, &AttributeSchema{
+				Name:        name,
+				Type:        hclTypeName(f.Type),
+				Required:    kind == "attr",
+				Meta:        meta,
+				Description: f.Tag.Get("description"),
+				Default:     f.Tag.Get("default"),
+				goType:      f.Type,
+			})
+		}
+	}
+
+	return s
+}
+
+// ParseHCLTag returns the name and kind from a fields hcl tag, i.e. `hcl:"name,optional"`
+func ParseHCLTag(f reflect.StructField) (string, string, bool) {
+	tag := f.Tag.Get("hcl")
+	if tag == "" {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(tag, ",", 2)
+	if len(parts) == 1 {
+		return parts[0], "attr", true
+	}
+
+	return parts[0], parts[1], true
+}
+
+// hclTypeName returns the HCL type expression for the given go type
+func hclTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return hclTypeName(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return fmt.Sprintf("list(%s)", hclTypeName(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map(%s)", hclTypeName(t.Elem()))
+	case reflect.Struct:
+		return "object"
+	}
+
+	return "any"
+}
+
+func jsonSchemaForBlock(b *BlockSchema) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for _, a := range b.Attributes {
+		p := jsonSchemaForType(a.goType)
+		if a.Description != "" {
+			p["description"] = a.Description
+		}
+
+		properties[a.Name] = p
+
+		if a.Required {
+			required = append(required, a.Name)
+		}
+	}
+
+	for _, nb := range b.Blocks {
+		block := jsonSchemaForBlock(nb)
+
+		// a repeated block can be written as a single object or an array
+		// of objects
+		if nb.Repeated {
+			block = map[string]interface{}{
+				"anyOf": []interface{}{
+					block,
+					map[string]interface{}{"type": "array", "items": block},
+				},
+			}
+		}
+
+		if nb.Description != "" {
+			block["description"] = nb.Description
+		}
+
+		properties[nb.Name] = block
+
+		if nb.Required {
+			required = append(required, nb.Name)
+		}
+	}
+
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+func jsonSchemaForType(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+
+	var s map[string]interface{}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchemaForType(t.Elem())
+	case reflect.String:
+		// strings can contain templates so no need to allow expressions
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		s = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		s = map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		s = map[string]interface{}{"type": "array", "items": jsonSchemaForType(t.Elem())}
+	case reflect.Map:
+		s = map[string]interface{}{"type": "object", "additionalProperties": jsonSchemaForType(t.Elem())}
+	case reflect.Struct:
+		s = map[string]interface{}{"type": "object"}
+	default:
+		// interface{} values accept anything
+		return map[string]interface{}{}
+	}
+
+	// values that are not strings can also be set using an expression
+	// i.e. cpu = "${var.cpu}"
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			s,
+			map[string]interface{}{"$ref": "#/definitions/expression"},
+		},
+	}
+}
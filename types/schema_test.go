@@ -0,0 +1,130 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSchemaPort struct {
+	Local  int `hcl:"local" description:"local port"`
+	Remote int `hcl:"remote,optional" default:"8080"`
+}
+
+type testSchemaResources struct {
+	CPU int `hcl:"cpu,optional"`
+}
+
+type testSchemaResource struct {
+	ResourceMetadata `hcl:",remain"`
+
+	Image     string               `hcl:"image" description:"image to use"`
+	Command   []string             `hcl:"command,optional"`
+	Env       map[string]string    `hcl:"env,optional"`
+	Ports     []testSchemaPort     `hcl:"port,block"`
+	Resources *testSchemaResources `hcl:"resources,block"`
+}
+
+func setupSchemaTypes() RegisteredTypes {
+	rt := DefaultTypes()
+	rt["container"] = &testSchemaResource{}
+
+	return rt
+}
+
+func TestSchemaReturnsNotRegisteredError(t *testing.T) {
+	_, err := setupSchemaTypes().Schema("foo")
+	require.ErrorIs(t, err, TypeNotRegisteredError)
+}
+
+func TestSchemaContainsAttributes(t *testing.T) {
+	s, err := setupSchemaTypes().Schema("container")
+	require.NoError(t, err)
+
+	require.Equal(t, "container", s.Name)
+
+	a := s.Attribute("image")
+	require.NotNil(t, a)
+	require.Equal(t, "string", a.Type)
+	require.True(t, a.Required)
+	require.False(t, a.Meta)
+	require.Equal(t, "image to use", a.Description)
+
+	a = s.Attribute("command")
+	require.Equal(t, "list(string)", a.Type)
+	require.False(t, a.Required)
+
+	a = s.Attribute("env")
+	require.Equal(t, "map(string)", a.Type)
+}
+
+func TestSchemaContainsMetaArguments(t *testing.T) {
+	s, err := setupSchemaTypes().Schema("container")
+	require.NoError(t, err)
+
+	a := s.Attribute("depends_on")
+	require.NotNil(t, a)
+	require.True(t, a.Meta)
+	require.False(t, a.Required)
+
+	a = s.Attribute("disabled")
+	require.NotNil(t, a)
+	require.True(t, a.Meta)
+	require.Equal(t, "bool", a.Type)
+
+	b := s.Block("lifecycle")
+	require.NotNil(t, b)
+	require.True(t, b.Meta)
+	require.False(t, b.Required)
+
+	require.False(t, s.Block("port").Meta)
+}
+
+func TestSchemaContainsNestedBlocks(t *testing.T) {
+	s, err := setupSchemaTypes().Schema("container")
+	require.NoError(t, err)
+
+	b := s.Block("port")
+	require.NotNil(t, b)
+	require.True(t, b.Repeated)
+	require.False(t, b.Required)
+	require.Equal(t, "number", b.Attribute("local").Type)
+	require.Equal(t, "local port", b.Attribute("local").Description)
+	require.Equal(t, "8080", b.Attribute("remote").Default)
+
+	b = s.Block("resources")
+	require.NotNil(t, b)
+	require.False(t, b.Repeated)
+	require.NotNil(t, b.Attribute("cpu"))
+}
+
+func TestSchemasReturnsAllTypesSorted(t *testing.T) {
+	s := setupSchemaTypes().Schemas()
+
+	require.Len(t, s, 4)
+	require.Equal(t, "container", s[0].Name)
+	require.Equal(t, "variable", s[3].Name)
+}
+
+func TestJSONSchemaDescribesTypes(t *testing.T) {
+	d, err := setupSchemaTypes().JSONSchema()
+	require.NoError(t, err)
+
+	doc := map[string]interface{}{}
+	err = json.Unmarshal(d, &doc)
+	require.NoError(t, err)
+
+	defs := doc["definitions"].(map[string]interface{})
+	require.Contains(t, defs, "container")
+	require.Contains(t, defs, "module")
+
+	cont := defs["container"].(map[string]interface{})
+	require.Contains(t, cont["required"], "image")
+	require.NotContains(t, cont["required"], "command")
+
+	props := cont["properties"].(map[string]interface{})
+	require.Equal(t, "string", props["image"].(map[string]interface{})["type"])
+	require.Contains(t, props, "port")
+	require.Contains(t, props, "depends_on")
+}
@@ -0,0 +1,384 @@
+package hclconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclwrite"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Format returns the canonical formatting of the given HCL source,
+// an error is returned if the source contains syntax errors
+func Format(src []byte) ([]byte, error) {
+	_, diags := hclsyntax.ParseConfig(src, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, errors.New(diags.Error())
+	}
+
+	return hclwrite.Format(src), nil
+}
+
+// FormatFile rewrites the given file with canonical formatting
+func FormatFile(file string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	out, err := Format(src)
+	if err != nil {
+		return fmt.Errorf("unable to format file %s: %s", file, err)
+	}
+
+	if bytes.Equal(src, out) {
+		return nil
+	}
+
+	return ioutil.WriteFile(file, out, 0644)
+}
+
+// ToHCL renders the config as canonically formatted HCL.
+// Resources that have been loaded from a module are not written, instead the
+// module block is written preserving the module structure.
+// When the original value of an attribute was a link to another resource or a
+// variable the reference is written rather than the resolved value, variables
+// are written as they were defined.
+func (c *Config) ToHCL() ([]byte, error) {
+	w := newHCLWriter(c)
+
+	for _, v := range c.variables {
+		err := w.writeSourceBlock(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range c.Resources {
+		if r.Metadata().Module != "" {
+			continue
+		}
+
+		body, _ := c.getBody(r)
+
+		err := w.writeResource(r, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return w.bytes(), nil
+}
+
+// ResourceToHCL renders a single resource as canonically formatted HCL
+func (c *Config) ResourceToHCL(r types.Resource) ([]byte, error) {
+	w := newHCLWriter(c)
+
+	body, _ := c.getBody(r)
+
+	err := w.writeResource(r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.bytes(), nil
+}
+
+// hclWriter renders resources as HCL using the hcl tags on the
+// resource structs
+type hclWriter struct {
+	buf *bytes.Buffer
+
+	// config contains the source of the parsed files
+	config *Config
+}
+
+func newHCLWriter(c *Config) *hclWriter {
+	return &hclWriter{buf: bytes.NewBuffer(nil), config: c}
+}
+
+func (w *hclWriter) bytes() []byte {
+	return hclwrite.Format(w.buf.Bytes())
+}
+
+func (w *hclWriter) writeResource(r types.Resource, body *hclsyntax.Body) error {
+	if w.buf.Len() > 0 {
+		w.buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(w.buf, "%s %q {\n", r.Metadata().Type, r.Metadata().Name)
+
+	err := w.writeBody(reflect.ValueOf(r), body)
+	if err != nil {
+		return fmt.Errorf("unable to write resource %s.%s: %s", r.Metadata().Type, r.Metadata().Name, err)
+	}
+
+	w.buf.WriteString("}\n")
+
+	return nil
+}
+
+// writeSourceBlock writes the original source for a block
+func (w *hclWriter) writeSourceBlock(b *hclsyntax.Block) error {
+	src := w.config.source(b.Range())
+	if src == nil {
+		return fmt.Errorf("unable to read source for %s %s: source for file %s has not been parsed", b.Type, strings.Join(b.Labels, "."), b.Range().Filename)
+	}
+
+	if w.buf.Len() > 0 {
+		w.buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(w.buf, "%s\n", src)
+
+	return nil
+}
+
+// writeBody writes the attributes and then the blocks for the struct v, body is
+// the original parsed body and can be nil when the resource was not created by
+// the parser
+func (w *hclWriter) writeBody(v reflect.Value, body *hclsyntax.Body) error {
+	err := w.writeAttributes(v, body, false, map[string]bool{})
+	if err != nil {
+		return err
+	}
+
+	return w.writeBlocks(v, body, false, map[string]int{})
+}
+
+func (w *hclWriter) writeAttributes(v reflect.Value, body *hclsyntax.Body, meta bool, written map[string]bool) error {
+	v = reflect.Indirect(v)
+
+	for i := 0; i < v.NumField(); i++ {
+		name, kind, ok := types.ParseHCLTag(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "remain":
+			// embedded meta data i.e. depends_on, disabled
+			err := w.writeAttributes(v.Field(i), body, true, written)
+			if err != nil {
+				return err
+			}
+		case "attr", "optional":
+			// resources can redefine meta-arguments, only write once
+			if written[name] {
+				continue
+			}
+
+			err := w.writeAttribute(name, v.Field(i), body, kind == "optional", meta)
+			if err != nil {
+				return err
+			}
+
+			written[name] = true
+		}
+	}
+
+	return nil
+}
+
+func (w *hclWriter) writeBlocks(v reflect.Value, body *hclsyntax.Body, meta bool, blockIndex map[string]int) error {
+	v = reflect.Indirect(v)
+
+	for i := 0; i < v.NumField(); i++ {
+		name, kind, ok := types.ParseHCLTag(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "remain":
+			// embedded meta blocks i.e. lifecycle
+			err := w.writeBlocks(v.Field(i), body, true, blockIndex)
+			if err != nil {
+				return err
+			}
+		case "block":
+			fv := v.Field(i)
+			if fv.Kind() != reflect.Slice {
+				fv = reflect.ValueOf([]interface{}{fv.Interface()})
+			}
+
+			for n := 0; n < fv.Len(); n++ {
+				bv := reflect.ValueOf(fv.Index(n).Interface())
+				if bv.Kind() == reflect.Ptr && bv.IsNil() {
+					continue
+				}
+
+				// like meta-arguments, meta blocks are only written when they
+				// were originally defined
+				if meta && body != nil && findBlock(body, name, blockIndex[name]) == nil {
+					continue
+				}
+
+				fmt.Fprintf(w.buf, "\n%s {\n", name)
+
+				err := w.writeBody(bv, findBlock(body, name, blockIndex[name]))
+				if err != nil {
+					return err
+				}
+
+				blockIndex[name]++
+				w.buf.WriteString("}\n")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *hclWriter) writeAttribute(name string, v reflect.Value, body *hclsyntax.Body, optional, meta bool) error {
+	var attr *hclsyntax.Attribute
+	if body != nil {
+		attr = body.Attributes[name]
+	}
+
+	// the values of meta-arguments like depends_on are modified when the
+	// config is processed, only write them when they were originally defined
+	if meta && body != nil && attr == nil {
+		return nil
+	}
+
+	// references to other resources and variables are written as the original expression
+	if attr != nil && len(attr.Expr.Variables()) > 0 {
+		return w.writeSource(name, attr.Expr.Range())
+	}
+
+	// interface values contain the unevaluated expression
+	if a, ok := v.Interface().(*hcl.Attribute); ok {
+		return w.writeSource(name, a.Expr.Range())
+	}
+
+	if optional && v.IsZero() {
+		return nil
+	}
+
+	val, err := goValueToCty(v)
+	if err != nil {
+		return fmt.Errorf("unable to write attribute %s: %s", name, err)
+	}
+
+	fmt.Fprintf(w.buf, "%s = %s\n", name, hclwrite.TokensForValue(val).Bytes())
+
+	return nil
+}
+
+// writeSource writes the original source for an expression, the source is
+// read from the files stored when the config was parsed
+func (w *hclWriter) writeSource(name string, r hcl.Range) error {
+	src := w.config.source(r)
+	if src == nil {
+		return fmt.Errorf("unable to read source for attribute %s: source for file %s has not been parsed", name, r.Filename)
+	}
+
+	fmt.Fprintf(w.buf, "%s = %s\n", name, src)
+
+	return nil
+}
+
+// findBlock returns the body of the nth block with the given type
+func findBlock(body *hclsyntax.Body, blockType string, index int) *hclsyntax.Body {
+	if body == nil {
+		return nil
+	}
+
+	n := 0
+	for _, b := range body.Blocks {
+		if b.Type != blockType {
+			continue
+		}
+
+		if n == index {
+			return b.Body
+		}
+
+		n++
+	}
+
+	return nil
+}
+
+// goValueToCty converts a go value into a cty value, struct fields
+// are named using the hcl or json tags
+func goValueToCty(v reflect.Value) (cty.Value, error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+
+		return goValueToCty(v.Elem())
+	case reflect.String:
+		return cty.StringVal(v.String()), nil
+	case reflect.Bool:
+		return cty.BoolVal(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cty.NumberIntVal(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cty.NumberUIntVal(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return cty.NumberFloatVal(v.Float()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+
+		vals := []cty.Value{}
+		for i := 0; i < v.Len(); i++ {
+			val, err := goValueToCty(v.Index(i))
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			vals = append(vals, val)
+		}
+
+		return cty.TupleVal(vals), nil
+	case reflect.Map:
+		if v.Len() == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+
+		vals := map[string]cty.Value{}
+		iter := v.MapRange()
+		for iter.Next() {
+			val, err := goValueToCty(iter.Value())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			vals[fmt.Sprintf("%v", iter.Key().Interface())] = val
+		}
+
+		return cty.ObjectVal(vals), nil
+	case reflect.Struct:
+		vals := map[string]cty.Value{}
+		for i := 0; i < v.NumField(); i++ {
+			name := structFieldName(v.Type().Field(i))
+			if name == "" {
+				continue
+			}
+
+			val, err := goValueToCty(v.Field(i))
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			vals[name] = val
+		}
+
+		return cty.ObjectVal(vals), nil
+	}
+
+	return cty.NilVal, fmt.Errorf("type %s can not be converted", v.Type())
+}
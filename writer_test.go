@@ -0,0 +1,174 @@
+package hclconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shipyard-run/hclconfig/test_fixtures/structs"
+	"github.com/shipyard-run/hclconfig/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatReturnsCanonicalHCL(t *testing.T) {
+	out, err := Format([]byte("container \"base\" {\ncommand=[\"a\"]\n    dns = [\"b\"]\n}\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "container \"base\" {\n  command = [\"a\"]\n  dns     = [\"b\"]\n}\n", string(out))
+}
+
+func TestFormatWithInvalidSyntaxReturnsError(t *testing.T) {
+	_, err := Format([]byte("container \"base\" {\n"))
+	require.Error(t, err)
+}
+
+func TestFormatFileRewritesFile(t *testing.T) {
+	f := CreateTestFile(t, "network \"onprem\" {\nsubnet=\"10.0.0.0/16\"\n}\n")
+
+	err := FormatFile(f)
+	require.NoError(t, err)
+
+	d, err := os.ReadFile(f)
+	require.NoError(t, err)
+	require.Equal(t, "network \"onprem\" {\n  subnet = \"10.0.0.0/16\"\n}\n", string(d))
+}
+
+func TestToHCLWritesResourcesWithReferences(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/simple/container.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	out, err := c.ToHCL()
+	require.NoError(t, err)
+
+	hcl := string(out)
+
+	require.Contains(t, hcl, `network "onprem" {`)
+	require.Contains(t, hcl, `name       = resource.network.onprem.name`)
+	require.Contains(t, hcl, `destination = "/test/${resource.template.consul_config.destination}"`)
+
+	// variables are written and references to them are kept
+	require.Contains(t, hcl, `variable "cpu_resources" {`)
+	require.Contains(t, hcl, `cpu     = var.cpu_resources`)
+
+	// the output should be parsable
+	f := CreateTestFile(t, hcl)
+	c2, p2 := setupParser(t)
+
+	err = p2.ParseFile(f, c2)
+	require.NoError(t, err)
+	require.Equal(t, c.ResourceCount(), c2.ResourceCount())
+}
+
+func TestToHCLUsesSourceFromParse(t *testing.T) {
+	f := CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+}
+
+container "consul" {
+  network {
+    name = resource.network.onprem.name
+  }
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ParseFile(f, c)
+	require.NoError(t, err)
+
+	// the file is changed after parsing, the original source is written
+	err = os.WriteFile(f, []byte("# changed"), 0644)
+	require.NoError(t, err)
+
+	out, err := c.ToHCL()
+	require.NoError(t, err)
+	require.Contains(t, string(out), `name = resource.network.onprem.name`)
+}
+
+func TestToHCLPreservesModuleStructure(t *testing.T) {
+	absoluteFolderPath, err := filepath.Abs("./test_fixtures/modules/modules.hcl")
+	require.NoError(t, err)
+
+	c, p := setupParser(t)
+
+	err = p.ParseFile(absoluteFolderPath, c)
+	require.NoError(t, err)
+
+	out, err := c.ToHCL()
+	require.NoError(t, err)
+
+	hcl := string(out)
+
+	require.Contains(t, hcl, `module "consul_1" {`)
+	require.Contains(t, hcl, `source = "../single"`)
+	require.NotContains(t, hcl, `module.consul_1.resource`)
+	require.Contains(t, hcl, `value = module.consul_1.output.container_resources_cpu`)
+}
+
+func TestResourceToHCLWritesResourcesNotCreatedByParser(t *testing.T) {
+	c := NewConfig()
+
+	r, _ := types.RegisteredTypes{"container": &structs.Container{}}.CreateResource("container", "test")
+	cont := r.(*structs.Container)
+	cont.Command = []string{"consul", "agent"}
+	cont.Env = map[string]string{"foo": "bar"}
+	cont.Networks = []structs.NetworkAttachment{{Name: "one"}, {Name: "two", IPAddress: "10.0.0.2"}}
+	cont.DependsOn = []string{"resource.network.one"}
+
+	out, err := c.ResourceToHCL(cont)
+	require.NoError(t, err)
+
+	require.Equal(t, `container "test" {
+  depends_on = ["resource.network.one"]
+  command    = ["consul", "agent"]
+  env        = { foo = "bar" }
+
+  network {
+    name = "one"
+  }
+
+  network {
+    name       = "two"
+    ip_address = "10.0.0.2"
+  }
+}
+`, string(out))
+}
+
+func TestToHCLWritesLifecycleOnlyWhenDefined(t *testing.T) {
+	f := CreateTestFile(t, `
+network "onprem" {
+  subnet = "10.6.0.0/16"
+
+  lifecycle {
+    timeout = "30s"
+  }
+}
+
+network "dev" {
+  subnet = "10.7.0.0/16"
+}
+`)
+
+	c, p := setupParser(t)
+
+	err := p.ParseFile(f, c)
+	require.NoError(t, err)
+
+	// meta blocks set after parsing are not written
+	r, err := c.FindResource("resource.network.dev")
+	require.NoError(t, err)
+	r.Metadata().Lifecycle = &types.Lifecycle{Timeout: "10s"}
+
+	out, err := c.ToHCL()
+	require.NoError(t, err)
+
+	require.Contains(t, string(out), "lifecycle {\n    timeout = \"30s\"\n  }")
+	require.NotContains(t, string(out), "10s")
+}